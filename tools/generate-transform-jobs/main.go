@@ -23,6 +23,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	prowgen "istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
 	"istio.io/test-infra/tools/prowtrans/pkg/configuration"
 )
 
@@ -35,12 +37,19 @@ func exit(err error, context string) {
 	os.Exit(1)
 }
 
-var inputDir = flag.String("input-dir", "prow/config/istio-private_jobs", "directory of input jobs")
+var (
+	inputDir   = flag.String("input-dir", "prow/config/istio-private_jobs", "directory of input jobs")
+	baseConfig = flag.String("base-config", "", "prowgen .base.yaml file whose job_name_template names the jobs, the default template is used if not set")
+)
 
-// branchJobSlices updates transform jobs slices such as allow and deny jobs using a branch name
-func branchJobSlices(in []string, branch string) []string {
+// branchJobSlices updates transform jobs slices such as allow and deny jobs using a branch name. The names of the
+// master jobs of the org/repo are renamed with the job name template, the other ones are renamed following the
+// default naming scheme.
+func branchJobSlices(in []string, nameTemplate *prowgen.JobNameTemplate, org, repo, branch string) []string {
 	for key, val := range in {
-		if strings.HasSuffix(val, "_postsubmit") {
+		if name, ok := nameTemplate.Rebranch(val, org, repo, "master", branch); ok {
+			val = name
+		} else if strings.HasSuffix(val, "_postsubmit") {
 			val = strings.Replace(val, "_postsubmit", fmt.Sprintf("_%s_postsubmit", branch), 1)
 		} else if strings.HasSuffix(val, "_presubmit") {
 			val = strings.Replace(val, "_presubmit", fmt.Sprintf("_%s_presubmit", branch), 1)
@@ -68,6 +77,18 @@ func main() {
 		panic("too many arguments")
 	}
 
+	var bc spec.BaseConfig
+	if *baseConfig != "" {
+		var err error
+		if bc, err = prowgen.ReadBase(nil, *baseConfig); err != nil {
+			exit(err, "reading the prowgen base config failed")
+		}
+	}
+	nameTemplate, err := prowgen.ParseJobNameTemplate(bc.JobNameTemplate)
+	if err != nil {
+		exit(err, "parsing the job name template failed")
+	}
+
 	if flag.Arg(0) == "branch" {
 		if err := filepath.Walk(*inputDir, func(src string, file os.FileInfo, err error) error {
 			if err != nil {
@@ -89,8 +110,8 @@ func main() {
 				jobs.Defaults.Modifier = strings.Replace(jobs.Defaults.Modifier, "master_", fmt.Sprintf("%s_", branch), 1)
 
 				for key, transform := range jobs.Transforms {
-					transform.JobAllowlist = branchJobSlices(transform.JobAllowlist, branch)
-					transform.JobDenylist = branchJobSlices(transform.JobDenylist, branch)
+					transform.JobAllowlist = branchJobSlices(transform.JobAllowlist, nameTemplate, jobs.Org, jobs.Repo, branch)
+					transform.JobDenylist = branchJobSlices(transform.JobDenylist, nameTemplate, jobs.Org, jobs.Repo, branch)
 
 					for key, val := range transform.Labels {
 						transform.Labels[key] = strings.Replace(val, "master", branch, 1)
@@ -19,14 +19,18 @@ package main
 import (
 	"reflect"
 	"testing"
+
+	prowgen "istio.io/test-infra/tools/prowgen/pkg"
 )
 
 func TestBranchJobSlices(t *testing.T) {
 	testInstances := []struct {
-		Name       string
-		Values     []string
-		BranchName string
-		Out        []string
+		Name         string
+		Values       []string
+		NameTemplate string
+		Repo         string
+		BranchName   string
+		Out          []string
 	}{
 		{
 			Name: "postsubmit",
@@ -48,11 +52,44 @@ func TestBranchJobSlices(t *testing.T) {
 				"foo_test_presubmit",
 			},
 		},
+		{
+			Name: "default template",
+			Values: []string{
+				"release_istio_postsubmit",
+				"release-notes_istio",
+				"nightly_istio_periodic",
+			},
+			Repo:       "istio",
+			BranchName: "release-1.30",
+			Out: []string{
+				"release_istio_release-1.30_postsubmit",
+				"release-notes_istio_release-1.30",
+				"nightly_istio_release-1.30_periodic",
+			},
+		},
+		{
+			Name: "custom template",
+			Values: []string{
+				"istio-release-postsubmit-master",
+				"istio-unit-presubmit-master",
+			},
+			NameTemplate: "{{.Repo}}-{{.Job}}-{{.Type}}-{{.Branch}}",
+			Repo:         "istio",
+			BranchName:   "release-1.30",
+			Out: []string{
+				"istio-release-postsubmit-release-1.30",
+				"istio-unit-presubmit-release-1.30",
+			},
+		},
 	}
 
 	for _, test := range testInstances {
 		t.Run(test.Name, func(t *testing.T) {
-			result := branchJobSlices(test.Values, test.BranchName)
+			nameTemplate, err := prowgen.ParseJobNameTemplate(test.NameTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := branchJobSlices(test.Values, nameTemplate, "istio", test.Repo, test.BranchName)
 			if !reflect.DeepEqual(result, test.Out) {
 				t.Logf("Test \"%s\" failed: \n\t%+v \n\t\t not equal to \n\t%v", test.Name, result, test.Out)
 				t.Fail()
@@ -0,0 +1,260 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// Status of the files of a branchPlan.
+const (
+	fileCreate    = "create"
+	fileUnchanged = "unchanged"
+	fileConflict  = "conflict"
+	fileOverwrite = "overwrite"
+)
+
+// branchPlan is the list of changes made by the branch command to create the
+// meta config files of a new release branch.
+type branchPlan struct {
+	Branch       string         `json:"branch"`
+	Files        []branchFile   `json:"files"`
+	ImageTags    []pkg.ImageTag `json:"image_tags"`
+	FilteredJobs []filteredJob  `json:"filtered_jobs"`
+}
+
+// branchFile is a meta config file to create for the new release branch.
+// Status is create if the file does not exist yet, unchanged if it already
+// exists with the same content, and conflict (or overwrite with --force) if it
+// exists with a different content.
+type branchFile struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	Status string `json:"status"`
+
+	content []byte
+}
+
+// filteredJob is a job left out of the new release branch because it sets
+// disable_release_branching.
+type filteredJob struct {
+	File string `json:"file"`
+	Job  string `json:"job"`
+}
+
+// planBranch computes the changes needed to create the meta config files of
+// the release branch for all the meta config files under dir that support
+// release branching.
+func planBranch(bc spec.BaseConfig, dir, release string, force bool) (*branchPlan, error) {
+	branch := "release-" + release
+	plan := &branchPlan{Branch: branch, Files: []branchFile{}, ImageTags: []pkg.ImageTag{}, FilteredJobs: []filteredJob{}}
+	seenTags := map[pkg.ImageTag]bool{}
+	err := walkMetaConfigs(bc, dir, func(cli *pkg.Client, src string, file os.DirEntry) error {
+		cfg, err := cli.ReadJobsConfig(src)
+		if err != nil {
+			return err
+		}
+		if !cfg.SupportReleaseBranching {
+			return nil
+		}
+		filtered := sets.NewString()
+		for _, job := range cfg.Jobs {
+			if job.DisableReleaseBranching {
+				filtered.Insert(job.Name)
+				plan.FilteredJobs = append(plan.FilteredJobs, filteredJob{File: src, Job: job.Name})
+			}
+		}
+
+		defaultImage := cfg.Image
+		// The new branch is cut from master, so start from the image
+		// used by the master jobs.
+		if image, ok := cfg.Images["master"]; ok {
+			cfg.Image = image
+		}
+		if !isImageTemplate(cfg.Image) {
+			err, newImage, matchedImage := branchedImageName(cfg.Image, branch)
+			if err != nil {
+				return fmt.Errorf("error matching config image of %s: %w", src, err)
+			}
+
+			cfg.Image = newImage
+			if tag := (pkg.ImageTag{Source: matchedImage, Target: newImage}); !seenTags[tag] {
+				seenTags[tag] = true
+				plan.ImageTags = append(plan.ImageTags, tag)
+			}
+		}
+
+		content, err := branchedMetaConfig(src, branch, defaultImage, cfg.Image, filtered)
+		if err != nil {
+			return err
+		}
+
+		name := file.Name()
+		ext := filepath.Ext(name)
+		name = name[:len(name)-len(ext)] + "-" + release + ext
+
+		f := branchFile{Source: src, Path: filepath.Join(dir, name), Status: fileCreate, content: content}
+		existing, err := os.ReadFile(f.Path)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		case bytes.Equal(existing, content):
+			f.Status = fileUnchanged
+		case force:
+			f.Status = fileOverwrite
+		default:
+			f.Status = fileConflict
+		}
+		plan.Files = append(plan.Files, f)
+		return nil
+	})
+	return plan, err
+}
+
+// applyBranchPlan tags the images and writes the files of the plan. Nothing is
+// done if any of the files conflicts with an existing one.
+func applyBranchPlan(plan *branchPlan, tagger pkg.ImageTagger) error {
+	var conflicts []string
+	for _, f := range plan.Files {
+		if f.Status == fileConflict {
+			conflicts = append(conflicts, f.Path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("refusing to overwrite files that already exist with a different content, use --force to overwrite them: %s",
+			strings.Join(conflicts, ", "))
+	}
+
+	for _, tag := range plan.ImageTags {
+		if err := tagger.Tag(tag.Source, tag.Target); err != nil {
+			return fmt.Errorf("unable to add image tag %q: %w", tag.Target, err)
+		}
+	}
+	for _, f := range plan.Files {
+		if f.Status == fileUnchanged {
+			continue
+		}
+		if err := os.WriteFile(f.Path, f.content, 0o644); err != nil {
+			return fmt.Errorf("error writing branches config: %w", err)
+		}
+	}
+	return nil
+}
+
+// branchedMetaConfig returns the meta config file of the release branch for the
+// src file. It is a copy of src that keeps its comments and formatting, with
+// only the branches, the images and support_release_branching changed and the
+// filtered jobs removed. Fields inherited from the .base.yaml files are left
+// to be inherited by the new file, except for the image.
+func branchedMetaConfig(src, branch, defaultImage, image string, filtered sets.String) ([]byte, error) {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	ed, err := newYAMLEditor(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", src, err)
+	}
+	root, end := ed.root, len(ed.lines)
+
+	// Fields added to the file go after the org and repo.
+	insertAt := 0
+	for _, key := range []string{"org", "repo"} {
+		if i := entry(root, key); i >= 0 {
+			insertAt = max(insertAt, ed.entryEnd(root, i, end))
+		}
+	}
+	var inserted []string
+	if i := entry(root, "branches"); i >= 0 {
+		if err := ed.setSequence(root, i, end, []string{branch}); err != nil {
+			return nil, err
+		}
+	} else {
+		inserted = append(inserted, "branches: ["+branch+"]")
+	}
+	if i := entry(root, "image"); i >= 0 && root.Content[i+1].Value != image {
+		text, err := formatScalar(image, root.Content[i+1].Style)
+		if err != nil {
+			return nil, err
+		}
+		ed.setValue(root, i, end, text)
+	} else if i < 0 && image != defaultImage {
+		// The image is inherited from .base.yaml or set in images, pin it
+		// for the branch.
+		text, err := formatScalar(image, 0)
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, "image: "+text)
+	}
+	if len(inserted) > 0 {
+		ed.insert(insertAt, inserted...)
+	}
+	if i := entry(root, "images"); i >= 0 {
+		ed.deleteEntry(root, i, end)
+	}
+	if i := entry(root, "support_release_branching"); i >= 0 {
+		ed.setValue(root, i, end, "false")
+	}
+
+	i := entry(root, "jobs")
+	if i < 0 {
+		return ed.bytes(), nil
+	}
+	jobs, jobsEnd := root.Content[i+1], ed.entryEnd(root, i, end)
+	for j, job := range jobs.Content {
+		if job.Kind != yamlv3.MappingNode {
+			continue
+		}
+		if k := entry(job, "name"); k >= 0 && filtered.Has(job.Content[k+1].Value) {
+			if err := ed.deleteItem(jobs, j, jobsEnd); err != nil {
+				return nil, fmt.Errorf("error removing job %s from %s: %w", job.Content[k+1].Value, src, err)
+			}
+			continue
+		}
+		k := entry(job, "image")
+		if k < 0 {
+			continue
+		}
+		jobImage := job.Content[k+1]
+		newImage := image
+		if jobImage.Value != defaultImage {
+			if isImageTemplate(jobImage.Value) {
+				continue
+			}
+			err, newImage, _ = branchedImageName(jobImage.Value, branch)
+			if err != nil {
+				return nil, fmt.Errorf("error matching image of job in %s at line %d: %w", src, jobImage.Line, err)
+			}
+		}
+		text, err := formatScalar(newImage, jobImage.Style)
+		if err != nil {
+			return nil, err
+		}
+		ed.setValue(job, k, ed.itemEnd(jobs, j, jobsEnd), text)
+	}
+	return ed.bytes(), nil
+}
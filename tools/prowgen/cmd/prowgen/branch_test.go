@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+const branchTestConfig = `org: istio
+repo: istio
+support_release_branching: true
+# The image is updated by the automator.
+image: gcr.io/istio-testing/build-tools:master-2024-01-01T00-00-00 # build-tools
+jobs:
+  - name: unit
+    command: [make, test]
+
+  # Only run on master.
+  - name: master-only
+    disable_release_branching: true
+    command: [make, nightly]
+
+  - name: lint
+    image: gcr.io/istio-testing/build-tools:master-2024-01-01T00-00-00
+    command:
+    - make
+    - lint
+`
+
+const branchedTestConfig = `org: istio
+repo: istio
+branches: [release-1.31]
+support_release_branching: false
+# The image is updated by the automator.
+image: gcr.io/istio-testing/build-tools:release-1.31-2024-01-01T00-00-00 # build-tools
+jobs:
+  - name: unit
+    command: [make, test]
+
+  - name: lint
+    image: gcr.io/istio-testing/build-tools:release-1.31-2024-01-01T00-00-00
+    command:
+    - make
+    - lint
+`
+
+type recordingTagger struct {
+	tags []pkg.ImageTag
+}
+
+func (t *recordingTagger) Tag(src, dst string) error {
+	t.tags = append(t.tags, pkg.ImageTag{Source: src, Target: dst})
+	return nil
+}
+
+func TestBranch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "istio.yaml")
+	dst := filepath.Join(dir, "istio-1.31.yaml")
+	if err := os.WriteFile(src, []byte(branchTestConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wantTags := []pkg.ImageTag{{
+		Source: "gcr.io/istio-testing/build-tools:master-2024-01-01T00-00-00",
+		Target: "gcr.io/istio-testing/build-tools:release-1.31-2024-01-01T00-00-00",
+	}}
+	status := func(plan *branchPlan) []string {
+		var res []string
+		for _, f := range plan.Files {
+			res = append(res, f.Path+" "+f.Status)
+		}
+		return res
+	}
+
+	plan, err := planBranch(spec.BaseConfig{}, dir, "1.31", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{dst + " " + fileCreate}, status(plan)); diff != "" {
+		t.Errorf("unexpected files (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff(wantTags, plan.ImageTags); diff != "" {
+		t.Errorf("unexpected image tags (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]filteredJob{{File: src, Job: "master-only"}}, plan.FilteredJobs); diff != "" {
+		t.Errorf("unexpected filtered jobs (-want, +got): %s", diff)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("planning must not write any file, got %v", err)
+	}
+
+	tagger := &recordingTagger{}
+	if err := applyBranchPlan(plan, tagger); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(dst); string(bs) != branchedTestConfig {
+		t.Errorf("unexpected branched config (-want, +got): %s", cmp.Diff(branchedTestConfig, string(bs)))
+	}
+	if diff := cmp.Diff(wantTags, tagger.tags); diff != "" {
+		t.Errorf("unexpected added tags (-want, +got): %s", diff)
+	}
+
+	// Re-running is a no-op.
+	plan, err = planBranch(spec.BaseConfig{}, dir, "1.31", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{dst + " " + fileUnchanged}, status(plan)); diff != "" {
+		t.Errorf("unexpected files on re-run (-want, +got): %s", diff)
+	}
+
+	// Files changed since then are only overwritten with force.
+	if err := os.WriteFile(dst, []byte("# edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = planBranch(spec.BaseConfig{}, dir, "1.31", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagger = &recordingTagger{}
+	if err := applyBranchPlan(plan, tagger); err == nil {
+		t.Fatal("expected an error for the conflicting file")
+	}
+	if len(tagger.tags) != 0 {
+		t.Errorf("no image must be tagged when refusing to write the files, got %v", tagger.tags)
+	}
+	if bs, _ := os.ReadFile(dst); string(bs) != "# edited\n" {
+		t.Errorf("conflicting file was overwritten: %q", bs)
+	}
+
+	plan, err = planBranch(spec.BaseConfig{}, dir, "1.31", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{dst + " " + fileOverwrite}, status(plan)); diff != "" {
+		t.Errorf("unexpected files with force (-want, +got): %s", diff)
+	}
+	if err := applyBranchPlan(plan, &recordingTagger{}); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(dst); string(bs) == "# edited\n" {
+		t.Error("conflicting file was not overwritten with force")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// baseExplanation is the effective base config of the meta config files of a
+// directory, with the .base.yaml files each field comes from.
+type baseExplanation struct {
+	Dir    string          `json:"dir"`
+	Files  []string        `json:"files"`
+	Config spec.BaseConfig `json:"config"`
+	Fields []pkg.BaseField `json:"fields"`
+}
+
+// baseFiles returns the .base.yaml files overlaid for the meta config files of
+// dir, under the input dir: the one of the input dir and the one of dir, like
+// walkMetaConfigs.
+func baseFiles(inputDir, dir string) ([]string, error) {
+	rel, err := filepath.Rel(inputDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("directory %s is not under the input dir %s", dir, inputDir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("directory %s does not exist", dir)
+	}
+	var files []string
+	for _, d := range []string{inputDir, dir} {
+		file := filepath.Join(d, ".base.yaml")
+		if _, err := os.Stat(file); os.IsNotExist(err) || (len(files) > 0 && files[0] == file) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func explainBase(inputDir, dir string) (*baseExplanation, error) {
+	files, err := baseFiles(inputDir, dir)
+	if err != nil {
+		return nil, err
+	}
+	bc, fields, err := pkg.ExplainBase(files...)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		files = []string{}
+	}
+	return &baseExplanation{Dir: dir, Files: files, Config: bc, Fields: fields}, nil
+}
+
+// printBaseExplanation prints the effective base config and the files its
+// fields come from in the given format, one of text or json.
+func printBaseExplanation(w io.Writer, e *baseExplanation, format string) error {
+	switch format {
+	case "text":
+		bs, err := yaml.Marshal(e.Config)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the base config: %w", err)
+		}
+		fmt.Fprintf(w, "Effective base config for %s:\n", e.Dir)
+		for _, line := range strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		fmt.Fprintln(w, "Fields set by:")
+		for _, f := range e.Fields {
+			fmt.Fprintf(w, "  %s: %s\n", f.Field, strings.Join(f.Files, ", "))
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	default:
+		return fmt.Errorf("unknown format %q, must be one of text, json", format)
+	}
+}
+
+// explainJob returns the provenance of the fields of the Prow job with the given
+// name, generated from one of the meta config files under dir.
+func explainJob(bc spec.BaseConfig, dir, name string) (*pkg.Explanation, error) {
+	var explanation *pkg.Explanation
+	errFound := errors.New("found")
+	err := walkMetaConfigs(bc, dir, func(cli *pkg.Client, src string, file os.DirEntry) error {
+		e, err := cli.Explain(src, name)
+		if errors.Is(err, pkg.ErrJobNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		explanation = e
+		return errFound
+	})
+	if err != nil && err != errFound {
+		return nil, err
+	}
+	if explanation == nil {
+		return nil, fmt.Errorf("%w: no meta config file under %s generates %s", pkg.ErrJobNotFound, dir, name)
+	}
+	return explanation, nil
+}
+
+// printExplanation prints the fields of the job with the layer they come from
+// in the given format, one of text or json.
+func printExplanation(w io.Writer, e *pkg.Explanation, format string) error {
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "%s (%s of %s, job %s of %s):\n", e.Name, e.Type, e.Branch, e.Job, e.File)
+		for _, f := range e.Fields {
+			value, err := json.Marshal(f.Value)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s: %w", f.Field, err)
+			}
+			layer := f.Layer
+			if f.Expanded {
+				layer += ", expanded"
+			}
+			fmt.Fprintf(w, "  %s: %s  # %s\n", f.Field, value, layer)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	default:
+		return fmt.Errorf("unknown format %q, must be one of text, json", format)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestExplainBase(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"jobs/.base.yaml":       "path_aliases:\n  istio: istio.io\nauto_max_procs: true\n",
+		"jobs/proxy/.base.yaml": "path_aliases:\n  envoyproxy: github.com/envoyproxy\nauto_max_procs: false\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := filepath.Join(dir, "jobs")
+
+	e, err := explainBase(input, filepath.Join(input, "proxy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := printBaseExplanation(&out, e, "text"); err != nil {
+		t.Fatal(err)
+	}
+	root, proxy := filepath.Join(input, ".base.yaml"), filepath.Join(input, "proxy", ".base.yaml")
+	expected := "Effective base config for " + filepath.Join(input, "proxy") + ":\n" +
+		"  path_aliases:\n" +
+		"    envoyproxy: github.com/envoyproxy\n" +
+		"    istio: istio.io\n" +
+		"  testgrid_config: {}\n" +
+		"Fields set by:\n" +
+		"  auto_max_procs: " + proxy + "\n" +
+		"  path_aliases.envoyproxy: " + proxy + "\n" +
+		"  path_aliases.istio: " + root + "\n"
+	if diff := cmp.Diff(expected, out.String()); diff != "" {
+		t.Errorf("Explanation does not match, (-want, +got): \n%s", diff)
+	}
+
+	// The root .base.yaml is only overlaid once for the input dir.
+	if e, err = explainBase(input, input); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{root}, e.Files); diff != "" {
+		t.Errorf("Files do not match, (-want, +got): \n%s", diff)
+	}
+
+	if _, err := explainBase(input, dir); err == nil {
+		t.Error("Expected an error for a directory outside of the input dir")
+	}
+}
+
+func TestExplainBaseMatchesWalk(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".base.yaml":       "imports: [shared.yaml]\nenv:\n- name: root\n  value: value\n",
+		"shared.yaml":      "params: {cluster: shared}\n",
+		"istio.yaml":       "org: istio\nrepo: istio\n",
+		"proxy/.base.yaml": "env:\n- name: proxy\n  value: value\n",
+		"proxy/proxy.yaml": "org: istio\nrepo: proxy\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bc, err := pkg.ReadBase(nil, filepath.Join(dir, ".base.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The meta config files are generated with the base config explain-base
+	// prints for their directory, the root one included.
+	walked := map[string]spec.BaseConfig{}
+	if err := walkMetaConfigs(bc, dir, func(cli *pkg.Client, src string, file os.DirEntry) error {
+		walked[filepath.Dir(src)] = cli.BaseConfig
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{dir, filepath.Join(dir, "proxy")} {
+		e, err := explainBase(dir, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(e.Config, walked[d]); diff != "" {
+			t.Errorf("Base config of %s does not match, (-explain-base, +walk): \n%s", d, diff)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	k8sProwConfig "sigs.k8s.io/prow/pkg/config"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+)
+
+// ref identifies a generated config file.
+type ref struct {
+	org    string
+	repo   string
+	branch string
+}
+
+// metaConfig is a meta config file to generate the jobs from, along with the
+// client configured with the .base.yaml files that apply to it.
+type metaConfig struct {
+	cli  *pkg.Client
+	src  string
+	name string
+}
+
+// generatedConfig is the job config generated from a meta config file for one
+// of its branches.
+type generatedConfig struct {
+	ref    ref
+	output k8sProwConfig.JobConfig
+}
+
+// generateJobs converts the meta config files with a pool of workers, and then
+// combines the outputs for the same org/repo/branch in the order of the files,
+// so the result is the same regardless of the number of workers.
+// In this way we can have multiple meta-config files for the same org/repo:branch.
+func generateJobs(configs []metaConfig, workers int) (map[ref]k8sProwConfig.JobConfig, error) {
+	results := make([][]generatedConfig, len(configs))
+	errs := parallelize(len(configs), workers, func(i int) error {
+		mc := configs[i]
+		cfg, err := mc.cli.ReadJobsConfig(mc.src)
+		if err != nil {
+			return err
+		}
+		for _, branch := range cfg.Branches {
+			output, err := mc.cli.ConvertJobConfig(mc.name, cfg, branch)
+			if err != nil {
+				return err
+			}
+			results[i] = append(results[i], generatedConfig{ref: ref{cfg.Org, cfg.Repo, branch}, output: output})
+		}
+		return nil
+	})
+	// Report the error of the first failing file, as the serial generation would.
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cachedOutput := map[ref]k8sProwConfig.JobConfig{}
+	for _, res := range results {
+		for _, gc := range res {
+			if _, ok := cachedOutput[gc.ref]; !ok {
+				cachedOutput[gc.ref] = gc.output
+			} else {
+				cachedOutput[gc.ref] = combineJobConfigs(cachedOutput[gc.ref], gc.output,
+					fmt.Sprintf("%s/%s", gc.ref.org, gc.ref.repo))
+			}
+		}
+	}
+	return cachedOutput, nil
+}
+
+// parallelize calls fn for each index in [0, n) with at most workers calls
+// running at the same time, and returns the errors indexed the same way.
+func parallelize(n, workers int, fn func(i int) error) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+)
+
+func TestGenerateJobsDeterministic(t *testing.T) {
+	bc, err := pkg.ReadBase(nil, "../../pkg/testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &pkg.Client{BaseConfig: bc}
+	var configs []metaConfig
+	// simple.yaml is listed twice so that the outputs for the same ref get combined.
+	for _, name := range []string{"simple.yaml", "matrix.yaml", "params.yaml", "simple.yaml"} {
+		configs = append(configs, metaConfig{cli: cli, src: "../../pkg/testdata/" + name, name: name})
+	}
+
+	marshal := func(workers int) map[ref]string {
+		outputs, err := generateJobs(configs, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := map[ref]string{}
+		for r, output := range outputs {
+			bs, err := yaml.Marshal(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res[r] = string(bs)
+		}
+		return res
+	}
+
+	serial := marshal(1)
+	for _, workers := range []int{2, 4, 8} {
+		if diff := cmp.Diff(serial, marshal(workers), cmp.AllowUnexported(ref{})); diff != "" {
+			t.Fatalf("Output with %d workers differs from the serial output, (-want, +got): \n%s", workers, diff)
+		}
+	}
+}
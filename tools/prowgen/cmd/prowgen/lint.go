@@ -0,0 +1,48 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// lintMetaConfigs lints all the meta config files under the input dir and
+// returns their problems, along with the ones of the .base.yaml files. The
+// meta config files a .base.yaml file that cannot be read applies to are not
+// linted, since their presets are unknown.
+func lintMetaConfigs(dir string) ([]pkg.Problem, error) {
+	var bc spec.BaseConfig
+	root := filepath.Join(dir, ".base.yaml")
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		bc, err = pkg.ReadBase(nil, root)
+		if err != nil {
+			return []pkg.Problem{{File: root, Message: err.Error()}}, nil
+		}
+	}
+
+	var problems []pkg.Problem
+	err := walkMetaConfigsWithBaseErrors(bc, dir, func(file string, err error) error {
+		problems = append(problems, pkg.Problem{File: file, Message: err.Error()})
+		return nil
+	}, func(cli *pkg.Client, src string, file os.DirEntry) error {
+		problems = append(problems, cli.Lint(src)...)
+		return nil
+	})
+	return problems, err
+}
@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLintMetaConfigs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"broken/.base.yaml":  "auto_max_procs: maybe\n",
+		"broken/istio.yaml":  "org: istio\nrepo: istio\n",
+		"proxy/proxy.yaml":   "org: istio\nrepo: proxy\nimage: fooimage\njobs:\n- name: unit_test\n  command: [make, test]\n",
+		"release/istio.yaml": "org: istio\nimage: fooimage\njobs:\n- name: unit\n  command: [make, test]\n",
+		"release/.base.yaml": "path_aliases:\n  istio: istio.io\n",
+		"release/notes.txt":  "not a meta config file\n",
+		"unknown/istio.yaml": "org: istio\nrepo: istio\nimage: fooimage\njobs:\n- name: unit\n  comand: [make, test]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := lintMetaConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	// The meta config files of broken are skipped, the other ones are
+	// still linted.
+	expected := []string{
+		filepath.Join(dir, "broken/.base.yaml") + `: failed to unmarshal "` + filepath.Join(dir, "broken/.base.yaml") +
+			`": error unmarshaling JSON: while decoding JSON: json: cannot unmarshal string into Go struct field .auto_max_procs of type bool`,
+		filepath.Join(dir, "proxy/proxy.yaml") + ":5:3: jobs[0].name: job may not contain '_' unit_test",
+		filepath.Join(dir, "release/istio.yaml") + ":1:1: repo: repo must be set",
+		filepath.Join(dir, "unknown/istio.yaml") + `:6:3: error unmarshaling JSON: while decoding JSON: json: unknown field "comand"`,
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("lint problems do not match, (-want, +got): \n%s", diff)
+	}
+}
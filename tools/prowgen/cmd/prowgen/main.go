@@ -24,13 +24,14 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
+	"strings"
 
 	"github.com/hashicorp/go-multierror"
 	shell "github.com/kballard/go-shellquote"
-	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	k8sProwConfig "sigs.k8s.io/prow/pkg/config"
-	"sigs.k8s.io/yaml"
 
 	"istio.io/test-infra/tools/prowgen/pkg"
 	"istio.io/test-infra/tools/prowgen/pkg/spec"
@@ -43,9 +44,19 @@ var (
 	inputDir            = flag.String("input-dir", "./prow/gcp/config/jobs", "directory of input jobs")
 	outputDir           = flag.String("output-dir", "./prow/gcp/cluster/jobs", "directory of output jobs")
 	preprocessCommand   = flag.String("pre-process-command", "", "command to run to preprocess the meta config files")
-	postprocessCommand  = flag.String("post-process-command", "", "command to run to postprocess the generated config files")
+	postprocessCommand  = flag.String("post-process-command", "", "command to run once to postprocess the generated config files, after all of them are written")
 	longJobNamesAllowed = flag.Bool("allow-long-job-names", false, "allow job names that are longer than 63 characters")
-	skipGarTagging      = flag.Bool("skip-gar-tagging", false, "skip tagging gar images since that is permitted by few folks")
+	skipGarTagging      = flag.Bool("skip-gar-tagging", false, "skip tagging gar images since that is permitted by few folks, and only log the commands to tag them with --image-tagger")
+	imageTagger         = flag.String("image-tagger", taggerGcloud, "how the branch command tags the images for the new branch, one of gcloud, registry, dry-run or manifest")
+	imageTagManifest    = flag.String("image-tag-manifest", "image-tags.yaml", "file to write the pending image tags to with --image-tagger=manifest")
+	jobs                = flag.Int("jobs", runtime.NumCPU(), "number of meta config files to generate and output files to write in parallel")
+	format              = flag.String("format", "text", "output format of the lint, diff, branch --dry-run, retire, explain and explain-base results, one of text or json")
+	dryRun              = flag.Bool("dry-run", false, "only print the files to create, image tags to add and jobs left out by the branch command, the files to remove by the retire command, or the stale files to remove by the write command")
+	pruneStale          = flag.Bool("prune-stale", false, "let the write command remove, and the check command fail on, the files under the output dir with the autogen header that are not generated by this run")
+	transformDirs       = flag.String("transform-dirs", "./prow/gcp/config/istio-private_jobs", "comma-separated directories of the prowtrans transform configs removed by the retire command")
+	force               = flag.Bool("force", false, "let the branch command overwrite existing files with a different content")
+	testgridConfig      = flag.String("testgrid-config", "", "TestGrid config file the write, check and testgrid commands generate the dashboards and dashboard groups of the jobs in, skipped if empty")
+	testgridPrefixes    = flag.String("testgrid-dashboard-prefixes", "istio", "comma-separated prefixes the TestGrid dashboards and dashboard groups must start with")
 )
 
 func main() {
@@ -53,112 +64,106 @@ func main() {
 
 	// TODO: deserves a better CLI...
 	if len(flag.Args()) < 1 {
-		panic("must provide one of write, print, check, branch")
-	} else if flag.Arg(0) == "branch" {
+		panic("must provide one of write, print, check, diff, testgrid, branch, retire, lint, explain, explain-base")
+	} else if flag.Arg(0) == "branch" || flag.Arg(0) == "retire" {
 		if len(flag.Args()) < 2 {
 			panic("must specify branch name")
 		}
+	} else if flag.Arg(0) == "explain-base" {
+		if len(flag.Args()) != 2 {
+			panic("must specify a single directory")
+		}
+	} else if flag.Arg(0) == "explain" {
+		if len(flag.Args()) != 2 {
+			panic("must specify a single job name")
+		}
 	} else if len(flag.Args()) != 1 {
 		panic("too many arguments")
 	}
+	if flag.Arg(0) == "testgrid" && *testgridConfig == "" {
+		panic("must specify --testgrid-config")
+	}
+
+	if flag.Arg(0) == "explain-base" {
+		e, err := explainBase(*inputDir, flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Error explaining the base config: %v", err)
+		}
+		if err := printBaseExplanation(os.Stdout, e, *format); err != nil {
+			log.Fatalf("Error printing the base config: %v", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "lint" {
+		problems, err := lintMetaConfigs(*inputDir)
+		if err != nil {
+			log.Fatalf("Walking through the meta config files failed: %v", err)
+		}
+		if err := printProblems(os.Stdout, problems, *format); err != nil {
+			log.Fatalf("Error printing lint results: %v", err)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
 	var bc spec.BaseConfig
 	if _, err := os.Stat(filepath.Join(*inputDir, ".base.yaml")); !os.IsNotExist(err) {
-		bc = pkg.ReadBase(nil, filepath.Join(*inputDir, ".base.yaml"))
+		bc, err = pkg.ReadBase(nil, filepath.Join(*inputDir, ".base.yaml"))
+		if err != nil {
+			log.Fatalf("Error reading base config: %v", err)
+		}
 	}
 
 	if flag.Arg(0) == "branch" {
-		if err := filepath.WalkDir(*inputDir, func(path string, d os.DirEntry, err error) error {
-			if d != nil && !d.IsDir() {
-				return nil
-			}
-			if err != nil {
-				log.Fatal(err)
-			}
-			baseConfig := bc
-			if _, err := os.Stat(filepath.Join(path, ".base.yaml")); !os.IsNotExist(err) {
-				baseConfig = pkg.ReadBase(&baseConfig, filepath.Join(path, ".base.yaml"))
-			}
-			cli := pkg.Client{BaseConfig: baseConfig, LongJobNamesAllowed: *longJobNamesAllowed}
-
-			imagesToTag := make(map[string]string)
-
-			files, _ := os.ReadDir(path)
-			for _, file := range files {
-				if file.IsDir() {
-					continue
-				}
-
-				if (filepath.Ext(file.Name()) != ".yaml" && filepath.Ext(file.Name()) != ".yml") ||
-					file.Name() == ".base.yaml" {
-					log.Println("skipping non-yaml file: ", file.Name())
-					continue
-				}
-
-				src := filepath.Join(path, file.Name())
-				cfg := cli.ReadJobsConfig(src)
-				cfg.Jobs = pkg.FilterReleaseBranchingJobs(cfg.Jobs)
-
-				if cfg.SupportReleaseBranching {
-					cfg.Env = filterDuplicateEnvVars(cfg.Env)
-
-					branch := "release-" + flag.Arg(1)
-
-					err, newImage, matchedImage := branchedImageName(cfg.Image, branch)
-					if err != nil {
-						log.Fatalf("Error matching config image: %v", err)
-					}
-
-					cfg.Image = newImage
-					if !*skipGarTagging {
-						if err := exec.Command("gcloud", "container", "images", "add-tag", matchedImage, newImage).Run(); err != nil {
-							log.Fatalf("Unable to add image tag %q: %v", newImage, err)
-						}
-					} else {
-						imagesToTag[matchedImage] = newImage
-					}
-
-					for index, job := range cfg.Jobs {
-						job.Env = filterDuplicateEnvVars(job.Env)
-
-						err, newImage, _ := branchedImageName(job.Image, branch)
-						if err != nil {
-							log.Fatalf("Error matching job image: %v", err)
-						}
-
-						cfg.Jobs[index].Image = newImage
-					}
-
-					cfg.Branches = []string{branch}
-					cfg.SupportReleaseBranching = false
-
-					name := file.Name()
-					ext := filepath.Ext(name)
-					name = name[:len(name)-len(ext)] + "-" + flag.Arg(1) + ext
-
-					dst := filepath.Join(*inputDir, name)
-					bytes, err := yaml.Marshal(cfg)
-					if err != nil {
-						log.Fatalf("Error marshaling jobs config: %v", err)
-					}
-
-					// Writes the job yaml
-					if err := os.WriteFile(dst, bytes, 0o644); err != nil {
-						log.Fatalf("Error writing branches config: %v", err)
-					}
-				}
-			}
-
-			if *skipGarTagging {
-				for matchedImage, newImage := range imagesToTag {
-					log.Printf("Please find a maintainer with sufficient permissions and have them run `gcloud container image add-tag %s %s`", matchedImage, newImage)
-				}
-			}
-
-			return nil
-		}); err != nil {
+		plan, err := planBranch(bc, *inputDir, flag.Arg(1), *force)
+		if err != nil {
 			log.Fatalf("Walking through the meta config files failed: %v", err)
 		}
+		if *dryRun {
+			if err := printBranchPlan(os.Stdout, plan, *format); err != nil {
+				log.Fatalf("Error printing the branch plan: %v", err)
+			}
+			return
+		}
+		tagger, err := newImageTagger()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := applyBranchPlan(plan, tagger); err != nil {
+			log.Fatal(err)
+		}
+	} else if flag.Arg(0) == "retire" {
+		var dirs []string
+		if *transformDirs != "" {
+			dirs = strings.Split(*transformDirs, ",")
+		}
+		plan, err := planRetire(bc, *inputDir, *outputDir, dirs, flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Walking through the config files failed: %v", err)
+		}
+		// The plan is printed once applied, to only report the files
+		// actually removed.
+		var applyErr error
+		if !*dryRun {
+			applyErr = applyRetirePlan(plan)
+		}
+		if err := printRetirePlan(os.Stdout, plan, *dryRun, *format); err != nil {
+			log.Fatalf("Error printing the retire plan: %v", err)
+		}
+		if applyErr != nil {
+			log.Fatal(applyErr)
+		}
+	} else if flag.Arg(0) == "explain" {
+		e, err := explainJob(bc, *inputDir, flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Error explaining the job: %v", err)
+		}
+		if err := printExplanation(os.Stdout, e, *format); err != nil {
+			log.Fatalf("Error printing the job explanation: %v", err)
+		}
 	} else {
 		if *preprocessCommand != "" {
 			if err := runProcessCommand(*preprocessCommand); err != nil {
@@ -166,81 +171,114 @@ func main() {
 			}
 		}
 
-		type ref struct {
-			org    string
-			repo   string
-			branch string
-		}
-		// Store the job config generated from all meta-config files in a cache map, and combine the
-		// job configs before we generate the final config files.
-		// In this way we can have multiple meta-config files for the same org/repo:branch
-		cachedOutput := map[ref]k8sProwConfig.JobConfig{}
-		if err := filepath.WalkDir(*inputDir, func(path string, d os.DirEntry, err error) error {
-			if d != nil && !d.IsDir() {
-				return nil
-			}
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			baseConfig := bc
-			if _, err := os.Stat(filepath.Join(path, ".base.yaml")); !os.IsNotExist(err) {
-				baseConfig = pkg.ReadBase(&baseConfig, filepath.Join(path, ".base.yaml"))
-			}
-			cli := pkg.Client{BaseConfig: baseConfig, LongJobNamesAllowed: *longJobNamesAllowed}
-
-			files, _ := os.ReadDir(path)
-			for _, file := range files {
-				if file.IsDir() {
-					continue
-				}
-
-				if (filepath.Ext(file.Name()) != ".yaml" && filepath.Ext(file.Name()) != ".yml") ||
-					file.Name() == ".base.yaml" {
-					log.Println("skipping non-yaml file: ", file.Name())
-					continue
-				}
-
-				src := filepath.Join(path, file.Name())
-				cfg := cli.ReadJobsConfig(src)
-				for _, branch := range cfg.Branches {
-					output, err := cli.ConvertJobConfig(file.Name(), cfg, branch)
-					if err != nil {
-						log.Fatal(err)
-					}
-					rf := ref{cfg.Org, cfg.Repo, branch}
-					if _, ok := cachedOutput[rf]; !ok {
-						cachedOutput[rf] = output
-					} else {
-						cachedOutput[rf] = combineJobConfigs(cachedOutput[rf], output,
-							fmt.Sprintf("%s/%s", cfg.Org, cfg.Repo))
-					}
-				}
-			}
+		var configs []metaConfig
+		if err := walkMetaConfigs(bc, *inputDir, func(cli *pkg.Client, src string, file os.DirEntry) error {
+			configs = append(configs, metaConfig{cli: cli, src: src, name: file.Name()})
 			return nil
 		}); err != nil {
 			log.Fatalf("Walking through the meta config files failed: %v", err)
 		}
+		cachedOutput, err := generateJobs(configs, *jobs)
+		if err != nil {
+			log.Fatalf("Generating the jobs failed: %v", err)
+		}
 
-		var err error
-		for r, output := range cachedOutput {
+		refs := make([]ref, 0, len(cachedOutput))
+		for r := range cachedOutput {
+			refs = append(refs, r)
+		}
+		sort.Slice(refs, func(i, j int) bool {
+			return outputFileName(refs[i].repo, refs[i].org, refs[i].branch) < outputFileName(refs[j].repo, refs[j].org, refs[j].branch)
+		})
+
+		var diffs []configDiff
+		fileDiffs := make([]configDiff, len(refs))
+		errs := parallelize(len(refs), *jobs, func(i int) error {
+			r := refs[i]
+			output := cachedOutput[r]
 			fname := outputFileName(r.repo, r.org, r.branch)
 			switch flag.Arg(0) {
 			case "write":
-				if e := pkg.Write(output, fname, bc.AutogenHeader); e != nil {
+				if *dryRun {
+					return nil
+				}
+				return pkg.Write(output, fname, bc.AutogenHeader)
+			case "check":
+				return pkg.Check(output, fname, bc.AutogenHeader)
+			case "diff":
+				jobDiffs, err := pkg.Diff(output, fname)
+				fileDiffs[i] = configDiff{Org: r.org, Repo: r.repo, Branch: r.branch, File: fname, Jobs: jobDiffs}
+				return err
+			}
+			return nil
+		})
+		for i, e := range errs {
+			if e != nil {
+				err = multierror.Append(err, e)
+			}
+			switch flag.Arg(0) {
+			case "print":
+				if e := pkg.Print(cachedOutput[refs[i]]); e != nil {
 					err = multierror.Append(err, e)
 				}
-				if *postprocessCommand != "" {
-					if e := runProcessCommand(*postprocessCommand); e != nil {
+			case "diff":
+				if len(fileDiffs[i].Jobs) > 0 {
+					diffs = append(diffs, fileDiffs[i])
+				}
+			}
+		}
+
+		// Other input dirs, or hand-kept files, may share the output dir and
+		// the autogen header, so the stale files are only pruned on demand.
+		if (flag.Arg(0) == "write" || flag.Arg(0) == "check") && *pruneStale {
+			generated := sets.NewString()
+			for r := range cachedOutput {
+				generated.Insert(filepath.Clean(outputFileName(r.repo, r.org, r.branch)))
+			}
+			stale, e := pkg.StaleFiles(*outputDir, bc.AutogenHeader, generated)
+			if e != nil {
+				err = multierror.Append(err, e)
+			}
+			for _, f := range stale {
+				switch {
+				case flag.Arg(0) == "check":
+					err = multierror.Append(err, fmt.Errorf("stale generated file %s is not generated from any meta config file", f))
+				case *dryRun:
+					log.Printf("Would remove stale generated file %s", f)
+				default:
+					log.Printf("Removing stale generated file %s", f)
+					if e := os.Remove(f); e != nil {
 						err = multierror.Append(err, e)
 					}
 				}
-			case "check":
-				if e := pkg.Check(output, fname, bc.AutogenHeader); e != nil {
+			}
+		}
+
+		if (flag.Arg(0) == "write" && !*dryRun) || flag.Arg(0) == "check" {
+			if *testgridConfig != "" {
+				if e := generateTestGridConfig(bc, refs, cachedOutput, flag.Arg(0)); e != nil {
 					err = multierror.Append(err, e)
 				}
-			case "print":
-				pkg.Print(output)
+			}
+		}
+
+		// The files are written in parallel, so the postprocess command
+		// runs once after all of them.
+		if flag.Arg(0) == "write" && *postprocessCommand != "" && !*dryRun {
+			if e := runProcessCommand(*postprocessCommand); e != nil {
+				err = multierror.Append(err, e)
+			}
+		}
+
+		if flag.Arg(0) == "testgrid" {
+			if e := generateTestGridConfig(bc, refs, cachedOutput, flag.Arg(0)); e != nil {
+				err = multierror.Append(err, e)
+			}
+		}
+
+		if flag.Arg(0) == "diff" {
+			if e := printDiffs(os.Stdout, diffs, *format); e != nil {
+				err = multierror.Append(err, e)
 			}
 		}
 
@@ -250,18 +288,121 @@ func main() {
 	}
 }
 
-func filterDuplicateEnvVars(env []v1.EnvVar) (filtered []v1.EnvVar) {
-	m := make(map[string]string)
-
-	for _, v := range env {
-		m[v.Name] = v.Value
+// generateTestGridConfig writes or checks the TestGrid config of the generated
+// jobs and of the other job config files under the output dir.
+func generateTestGridConfig(bc spec.BaseConfig, refs []ref, cachedOutput map[ref]k8sProwConfig.JobConfig, operation string) error {
+	generated := make([]pkg.GeneratedJobs, 0, len(refs))
+	for _, r := range refs {
+		generated = append(generated, pkg.GeneratedJobs{Org: r.org, Repo: r.repo, Branch: r.branch, Jobs: cachedOutput[r]})
+	}
+	others, err := pkg.ReadOtherJobConfigs(*outputDir, bc.AutogenHeader)
+	if err != nil {
+		return err
 	}
+	var prefixes []string
+	if *testgridPrefixes != "" {
+		prefixes = strings.Split(*testgridPrefixes, ",")
+	}
+	cfg, err := pkg.GenerateTestGridConfig(generated, others, prefixes)
+	if err != nil {
+		return err
+	}
+	if operation == "check" {
+		return pkg.CheckTestGridConfig(cfg, *testgridConfig, bc.AutogenHeader)
+	}
+	return pkg.WriteTestGridConfig(cfg, *testgridConfig, bc.AutogenHeader)
+}
 
-	for key, value := range m {
-		filtered = append(filtered, v1.EnvVar{Name: key, Value: value})
+// walkMetaConfigs calls fn for every meta config file under the input dir,
+// with a client configured with the .base.yaml files that apply to it, bc
+// being the one of the input dir. The walk stops at the first error.
+func walkMetaConfigs(bc spec.BaseConfig, dir string, fn func(cli *pkg.Client, src string, file os.DirEntry) error) error {
+	return walkMetaConfigsWithBaseErrors(bc, dir, func(_ string, err error) error {
+		return err
+	}, fn)
+}
+
+// walkMetaConfigsWithBaseErrors is walkMetaConfigs calling onBaseError with the
+// .base.yaml files that cannot be read, and skipping the meta config files of
+// their directory, instead of stopping. The walk still stops if onBaseError
+// returns an error.
+func walkMetaConfigsWithBaseErrors(bc spec.BaseConfig, dir string, onBaseError func(file string, err error) error,
+	fn func(cli *pkg.Client, src string, file os.DirEntry) error,
+) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if d != nil && !d.IsDir() {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// The .base.yaml file of the input dir is already the given base
+		// config, it is not overlaid on itself.
+		baseConfig := bc
+		baseFile := filepath.Join(path, ".base.yaml")
+		if _, err := os.Stat(baseFile); path != dir && !os.IsNotExist(err) {
+			baseConfig, err = pkg.ReadBase(&baseConfig, baseFile)
+			if err != nil {
+				return onBaseError(baseFile, err)
+			}
+		}
+		cli := &pkg.Client{BaseConfig: baseConfig, InputDir: dir, LongJobNamesAllowed: *longJobNamesAllowed}
+
+		files, _ := os.ReadDir(path)
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+
+			if (filepath.Ext(file.Name()) != ".yaml" && filepath.Ext(file.Name()) != ".yml") ||
+				file.Name() == ".base.yaml" {
+				log.Println("skipping non-yaml file: ", file.Name())
+				continue
+			}
+
+			if err := fn(cli, filepath.Join(path, file.Name()), file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const (
+	taggerGcloud   = "gcloud"
+	taggerRegistry = "registry"
+	taggerDryRun   = "dry-run"
+	taggerManifest = "manifest"
+)
+
+func newImageTagger() (pkg.ImageTagger, error) {
+	switch *imageTagger {
+	case taggerGcloud:
+		if *skipGarTagging {
+			return &pkg.DryRunTagger{Command: pkg.GcloudTagger{}.Command}, nil
+		}
+		return pkg.GcloudTagger{}, nil
+	case taggerRegistry:
+		if *skipGarTagging {
+			return &pkg.DryRunTagger{Command: pkg.RegistryTagger{}.Command}, nil
+		}
+		return pkg.RegistryTagger{}, nil
+	case taggerDryRun:
+		return &pkg.DryRunTagger{}, nil
+	case taggerManifest:
+		if *skipGarTagging {
+			return &pkg.DryRunTagger{}, nil
+		}
+		return &pkg.ManifestTagger{Path: *imageTagManifest}, nil
 	}
+	return nil, fmt.Errorf("unknown image tagger %q, must be one of %s, %s, %s, %s", *imageTagger, taggerGcloud, taggerRegistry, taggerDryRun, taggerManifest)
+}
 
-	return filtered
+// isImageTemplate returns true if the image references variables, e.g.
+// $(prowgen.branch), which are resolved for each branch when generating the jobs.
+func isImageTemplate(image string) bool {
+	return strings.Contains(image, "$(")
 }
 
 func branchedImageName(image string, branch string) (error, string, string) {
@@ -307,8 +448,14 @@ func runProcessCommand(rawCommand string) error {
 }
 
 func outputFileName(repo string, org string, branch string) string {
+	return generatedFileName(*outputDir, org, repo, branch)
+}
+
+// generatedFileName returns the path of the file generated under dir for the
+// jobs of the org/repo branch.
+func generatedFileName(dir, org, repo, branch string) string {
 	key := fmt.Sprintf("%s.%s.%s.gen.yaml", org, repo, branch)
-	return path.Join(*outputDir, org, repo, key)
+	return path.Join(dir, org, repo, key)
 }
 
 func combineJobConfigs(jc1, jc2 k8sProwConfig.JobConfig, orgRepo string) k8sProwConfig.JobConfig {
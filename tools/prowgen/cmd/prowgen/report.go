@@ -0,0 +1,150 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+)
+
+// configDiff is the job level diff of a generated config file.
+type configDiff struct {
+	Org    string        `json:"org"`
+	Repo   string        `json:"repo"`
+	Branch string        `json:"branch"`
+	File   string        `json:"file"`
+	Jobs   []pkg.JobDiff `json:"jobs"`
+}
+
+// printProblems prints the lint problems in the given format, one of text or json.
+func printProblems(w io.Writer, problems []pkg.Problem, format string) error {
+	switch format {
+	case "text":
+		for _, p := range problems {
+			fmt.Fprintln(w, p.String())
+		}
+		return nil
+	case "json":
+		if problems == nil {
+			problems = []pkg.Problem{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(problems)
+	default:
+		return fmt.Errorf("unknown format %q, must be one of text, json", format)
+	}
+}
+
+// printDiffs prints the job diffs grouped by org/repo/branch in the given
+// format, one of text or json.
+func printDiffs(w io.Writer, diffs []configDiff, format string) error {
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].File < diffs[j].File
+	})
+	switch format {
+	case "text":
+		for _, d := range diffs {
+			fmt.Fprintf(w, "%s/%s@%s (%s):\n", d.Org, d.Repo, d.Branch, d.File)
+			for _, j := range d.Jobs {
+				if len(j.Changes) == 0 {
+					fmt.Fprintf(w, "  %s\n", j)
+				}
+				for _, c := range j.Changes {
+					fmt.Fprintf(w, "  %s: %s\n", j, c)
+				}
+			}
+		}
+		return nil
+	case "json":
+		if diffs == nil {
+			diffs = []configDiff{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	default:
+		return fmt.Errorf("unknown format %q, must be one of text, json", format)
+	}
+}
+
+// printBranchPlan prints the plan in the given format, one of text or json.
+func printBranchPlan(w io.Writer, plan *branchPlan, format string) error {
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "Files for %s:\n", plan.Branch)
+		for _, f := range plan.Files {
+			fmt.Fprintf(w, "  %s %s (from %s)\n", f.Status, f.Path, f.Source)
+		}
+		if len(plan.ImageTags) > 0 {
+			fmt.Fprintln(w, "Image tags to add:")
+			for _, t := range plan.ImageTags {
+				fmt.Fprintf(w, "  %s → %s\n", t.Source, t.Target)
+			}
+		}
+		if len(plan.FilteredJobs) > 0 {
+			fmt.Fprintln(w, "Jobs with release branching disabled:")
+			for _, j := range plan.FilteredJobs {
+				fmt.Fprintf(w, "  %s: %s\n", j.File, j.Job)
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	default:
+		return fmt.Errorf("unknown format %q, must be one of text, json", format)
+	}
+}
+
+// printRetirePlan prints the files removed, or to remove with dryRun, and the
+// unattributed files of the plan in the given format, one of text or json.
+func printRetirePlan(w io.Writer, plan *retirePlan, dryRun bool, format string) error {
+	switch format {
+	case "text":
+		action := "Removed"
+		if dryRun {
+			action = "Files to remove"
+		}
+		fmt.Fprintf(w, "%s for %s:\n", action, plan.Branch)
+		for _, f := range plan.Files {
+			fmt.Fprintf(w, "  %s %s\n", f.Kind, f.Path)
+		}
+		if len(plan.Failed) > 0 {
+			fmt.Fprintln(w, "Failed to remove:")
+			for _, f := range plan.Failed {
+				fmt.Fprintf(w, "  %s %s: %s\n", f.Kind, f.Path, f.Error)
+			}
+		}
+		if len(plan.Unattributed) > 0 {
+			fmt.Fprintln(w, "Files to check manually:")
+			for _, f := range plan.Unattributed {
+				fmt.Fprintf(w, "  %s %s: %s\n", f.Kind, f.Path, f.Reason)
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	default:
+		return fmt.Errorf("unknown format %q, must be one of text, json", format)
+	}
+}
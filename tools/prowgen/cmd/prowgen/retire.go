@@ -0,0 +1,232 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// Kinds of the files of a retirePlan.
+const (
+	kindMetaConfig      = "meta config"
+	kindTransformConfig = "transform config"
+	kindGenerated       = "generated config"
+)
+
+// transformAutogenHeader is the header of the files generated by prowtrans
+// from the transform configs.
+const transformAutogenHeader = "# THIS FILE IS AUTOGENERATED. DO NOT EDIT. See tools/prowtrans/README.md"
+
+// retirePlan is the list of files removed by the retire command for a release
+// branch that reached its end of life. Once applied, Files only lists the
+// files actually removed, and Failed the ones that could not be.
+type retirePlan struct {
+	Branch       string             `json:"branch"`
+	Files        []retiredFile      `json:"files"`
+	Unattributed []unattributedFile `json:"unattributed"`
+	Failed       []failedFile       `json:"failed,omitempty"`
+}
+
+// retiredFile is a file that only belongs to the retired branch.
+type retiredFile struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+}
+
+// unattributedFile is a file that looks like it belongs to the retired branch,
+// e.g. because of its name, but cannot be removed safely, e.g. because it is
+// also used by other branches. It must be dealt with manually.
+type unattributedFile struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// failedFile is a file of the retired branch that could not be removed.
+type failedFile struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// transformConfig is the part of a prowtrans transform config needed to know
+// which branches it applies to.
+type transformConfig struct {
+	Defaults struct {
+		Branches []string `json:"branches"`
+	} `json:"defaults"`
+	Transforms []struct {
+		Branches []string `json:"branches"`
+	} `json:"transforms"`
+}
+
+// planRetire finds all the files belonging to the release branch: the meta
+// config files under dir, the transform configs under transformDirs and the
+// files generated from both under outputDir.
+func planRetire(bc spec.BaseConfig, dir, outputDir string, transformDirs []string, release string) (*retirePlan, error) {
+	branch := "release-" + release
+	plan := &retirePlan{Branch: branch, Files: []retiredFile{}, Unattributed: []unattributedFile{}}
+	// generated files that must be kept since they are still generated from a
+	// meta config file that is not retired.
+	kept := map[string]string{}
+
+	err := walkMetaConfigs(bc, dir, func(cli *pkg.Client, src string, file os.DirEntry) error {
+		cfg, err := cli.ReadJobsConfig(src)
+		if err != nil {
+			return err
+		}
+		switch reason := attributeBranches(cfg.Branches, branch, release); {
+		case reason == "":
+			plan.Files = append(plan.Files, retiredFile{Kind: kindMetaConfig, Path: src})
+		case sets.NewString(cfg.Branches...).Has(branch):
+			kept[filepath.Clean(generatedFileName(outputDir, cfg.Org, cfg.Repo, branch))] = src
+			fallthrough
+		case hasReleaseSuffix(file.Name(), release):
+			plan.Unattributed = append(plan.Unattributed, unattributedFile{Kind: kindMetaConfig, Path: src, Reason: reason})
+		}
+		return nil
+	})
+	if err != nil {
+		return plan, err
+	}
+
+	for _, transformDir := range transformDirs {
+		if err := walkYAMLFiles(transformDir, func(path string) error {
+			if filepath.Base(path) == ".defaults.yaml" {
+				return nil
+			}
+			bs, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var cfg transformConfig
+			if err := yaml.Unmarshal(bs, &cfg); err != nil {
+				return fmt.Errorf("error parsing transform config %s: %w", path, err)
+			}
+			branches := sets.NewString()
+			for _, t := range cfg.Transforms {
+				if len(t.Branches) > 0 {
+					branches.Insert(t.Branches...)
+				} else {
+					branches.Insert(cfg.Defaults.Branches...)
+				}
+			}
+			if reason := attributeBranches(branches.List(), branch, release); reason == "" {
+				plan.Files = append(plan.Files, retiredFile{Kind: kindTransformConfig, Path: path})
+			} else if branches.Has(branch) || hasReleaseSuffix(filepath.Base(path), release) {
+				plan.Unattributed = append(plan.Unattributed, unattributedFile{Kind: kindTransformConfig, Path: path, Reason: reason})
+			}
+			return nil
+		}); err != nil {
+			return plan, err
+		}
+	}
+
+	headers := [][]byte{[]byte(bc.AutogenHeader + "\n"), []byte(transformAutogenHeader + "\n")}
+	if bc.AutogenHeader == "" {
+		headers[0] = []byte(pkg.DefaultAutogenHeader + "\n")
+	}
+	err = walkYAMLFiles(outputDir, func(path string) error {
+		if !strings.HasSuffix(filepath.Base(path), "."+branch+".gen"+filepath.Ext(path)) {
+			return nil
+		}
+		if src, ok := kept[filepath.Clean(path)]; ok {
+			plan.Unattributed = append(plan.Unattributed, unattributedFile{
+				Kind: kindGenerated, Path: path, Reason: fmt.Sprintf("still generated from %s", src),
+			})
+			return nil
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, header := range headers {
+			if bytes.HasPrefix(bs, header) {
+				plan.Files = append(plan.Files, retiredFile{Kind: kindGenerated, Path: path})
+				return nil
+			}
+		}
+		plan.Unattributed = append(plan.Unattributed, unattributedFile{
+			Kind: kindGenerated, Path: path, Reason: "missing the autogen header of the files generated by prowgen or prowtrans",
+		})
+		return nil
+	})
+	return plan, err
+}
+
+// attributeBranches returns why a config file applying to the branches cannot
+// be attributed to the retired branch, or an empty string if it can.
+func attributeBranches(branches []string, branch, release string) string {
+	switch {
+	case len(branches) == 1 && branches[0] == branch:
+		return ""
+	case sets.NewString(branches...).Has(branch):
+		others := sets.NewString(branches...).Delete(branch)
+		return fmt.Sprintf("also used by the branches %v", others.List())
+	default:
+		return fmt.Sprintf("named after %s but used by the branches %v", release, branches)
+	}
+}
+
+// hasReleaseSuffix returns true if the config file is named after the
+// release, e.g. istio-1.28.yaml for 1.28.
+func hasReleaseSuffix(name, release string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), "-"+release)
+}
+
+// walkYAMLFiles calls fn for every YAML file under dir, in lexical order. A dir
+// that does not exist has no files.
+func walkYAMLFiles(dir string, fn func(path string) error) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// applyRetirePlan removes the files of the plan, and moves the ones that could
+// not be removed to its failed files. The unattributed files are left as is.
+func applyRetirePlan(plan *retirePlan) error {
+	removed := make([]retiredFile, 0, len(plan.Files))
+	for _, f := range plan.Files {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			plan.Failed = append(plan.Failed, failedFile{Kind: f.Kind, Path: f.Path, Error: err.Error()})
+			continue
+		}
+		removed = append(removed, f)
+	}
+	plan.Files = removed
+	if len(plan.Failed) > 0 {
+		return fmt.Errorf("failed to remove %d of the files of %s", len(plan.Failed), plan.Branch)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/test-infra/tools/prowgen/pkg"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestRetire(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "jobs")
+	output := filepath.Join(dir, "cluster")
+	transforms := filepath.Join(dir, "private")
+	header := pkg.DefaultAutogenHeader + "\n"
+	files := map[string]string{
+		"jobs/istio.yaml":      "org: istio\nrepo: istio\njobs: []\n",
+		"jobs/istio-1.28.yaml": "org: istio\nrepo: istio\nbranches: [release-1.28]\njobs: []\n",
+		"jobs/proxy-1.28.yaml": "org: istio\nrepo: proxy\nbranches: [release-1.28, release-1.29]\njobs: []\n",
+		"jobs/tools-1.28.yaml": "org: istio\nrepo: tools\nbranches: [release-1.29]\njobs: []\n",
+
+		"private/istio-1.28.yaml": "defaults:\n  branches: [release-1.28]\ntransforms:\n- labels: {}\n",
+		"private/istio.yaml":      "defaults:\n  branches: [master]\ntransforms:\n- labels: {}\n",
+		"private/proxy-1.28.yaml": "defaults:\n  branches: [release-1.28]\ntransforms:\n- labels: {}\n- branches: [release-1.29]\n",
+
+		"cluster/istio/istio/istio.istio.master.gen.yaml":                       header,
+		"cluster/istio/istio/istio.istio.release-1.28.gen.yaml":                 header,
+		"cluster/istio/proxy/istio.proxy.release-1.28.gen.yaml":                 header,
+		"cluster/istio/api/istio.api.release-1.28.gen.yaml":                     "# hand written\n",
+		"cluster/istio-private/istio/istio-private.istio.release-1.28.gen.yaml": transformAutogenHeader + "\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	plan, err := planRetire(spec.BaseConfig{}, input, output, []string{transforms, p("missing")}, "1.28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []retiredFile{
+		{Kind: kindMetaConfig, Path: p("jobs/istio-1.28.yaml")},
+		{Kind: kindTransformConfig, Path: p("private/istio-1.28.yaml")},
+		{Kind: kindGenerated, Path: p("cluster/istio/istio/istio.istio.release-1.28.gen.yaml")},
+		{Kind: kindGenerated, Path: p("cluster/istio-private/istio/istio-private.istio.release-1.28.gen.yaml")},
+	}
+	if diff := cmp.Diff(wantFiles, plan.Files); diff != "" {
+		t.Errorf("unexpected files (-want, +got): %s", diff)
+	}
+	wantUnattributed := []unattributedFile{
+		{Kind: kindMetaConfig, Path: p("jobs/proxy-1.28.yaml"), Reason: "also used by the branches [release-1.29]"},
+		{Kind: kindMetaConfig, Path: p("jobs/tools-1.28.yaml"), Reason: "named after 1.28 but used by the branches [release-1.29]"},
+		{Kind: kindTransformConfig, Path: p("private/proxy-1.28.yaml"), Reason: "also used by the branches [release-1.29]"},
+		{
+			Kind: kindGenerated, Path: p("cluster/istio/api/istio.api.release-1.28.gen.yaml"),
+			Reason: "missing the autogen header of the files generated by prowgen or prowtrans",
+		},
+		{Kind: kindGenerated, Path: p("cluster/istio/proxy/istio.proxy.release-1.28.gen.yaml"), Reason: "still generated from " + p("jobs/proxy-1.28.yaml")},
+	}
+	if diff := cmp.Diff(wantUnattributed, plan.Unattributed); diff != "" {
+		t.Errorf("unexpected unattributed files (-want, +got): %s", diff)
+	}
+
+	if err := applyRetirePlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		_, err := os.Stat(p(name))
+		removed := false
+		for _, f := range wantFiles {
+			removed = removed || f.Path == p(name)
+		}
+		if removed != os.IsNotExist(err) {
+			t.Errorf("%s: expected removed=%v, got %v", name, removed, err)
+		}
+	}
+
+	// The files that cannot be removed, e.g. non-empty directories, are
+	// reported apart from the removed ones, and the ones already removed.
+	if err := os.MkdirAll(p("cluster/istio/istio/istio.istio.release-1.28.gen.yaml/child"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	plan = &retirePlan{Branch: "release-1.28", Files: wantFiles}
+	if err := applyRetirePlan(plan); err == nil {
+		t.Fatal("Expected an error for the file that cannot be removed")
+	}
+	if diff := cmp.Diff(append(wantFiles[:2:2], wantFiles[3]), plan.Files); diff != "" {
+		t.Errorf("unexpected removed files (-want, +got): %s", diff)
+	}
+	if len(plan.Failed) != 1 || plan.Failed[0].Path != wantFiles[2].Path {
+		t.Errorf("Expected %s to fail to be removed, got %v", wantFiles[2].Path, plan.Failed)
+	}
+}
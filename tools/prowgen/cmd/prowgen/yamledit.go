@@ -0,0 +1,250 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// yamlEditor edits a YAML document at the positions of the nodes of its tree.
+// Only the lines of the edited nodes are rewritten, so that the comments, blank
+// lines and indentation of the rest of the document are preserved, which is
+// not the case when encoding the tree again.
+type yamlEditor struct {
+	// root is the top-level mapping of the document.
+	root  *yamlv3.Node
+	lines []string
+	edits []lineEdit
+}
+
+// lineEdit replaces the lines in [start, end) with the given lines. Lines are
+// inserted if start == end.
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+func newYAMLEditor(content []byte) (*yamlEditor, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, errors.New("the document is not a YAML mapping")
+	}
+	return &yamlEditor{root: doc.Content[0], lines: strings.Split(string(content), "\n")}, nil
+}
+
+// entry returns the index of the key in the mapping, or -1 if it is not set.
+func entry(m *yamlv3.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// entryEnd returns the line index after the region of the entry of the
+// mapping at index i, given the line index after the region of the mapping.
+func (e *yamlEditor) entryEnd(m *yamlv3.Node, i, parentEnd int) int {
+	next := parentEnd
+	if i+2 < len(m.Content) {
+		next = m.Content[i+2].Line - 1
+	}
+	return e.regionEnd(m.Content[i].Line-1, next)
+}
+
+// itemStart returns the line index of the "-" indicator of the sequence item.
+func (e *yamlEditor) itemStart(item *yamlv3.Node) int {
+	start := item.Line - 1
+	if start > 0 && strings.TrimSpace(e.lines[start-1]) == "-" {
+		start--
+	}
+	return start
+}
+
+// itemEnd returns the line index after the region of the item of the sequence
+// at index i, given the line index after the region of the sequence.
+func (e *yamlEditor) itemEnd(s *yamlv3.Node, i, parentEnd int) int {
+	next := parentEnd
+	if i+1 < len(s.Content) {
+		next = e.itemStart(s.Content[i+1])
+	}
+	return e.regionEnd(e.itemStart(s.Content[i]), next)
+}
+
+// regionEnd returns the line index after the last line of a region that
+// starts at start and ends before next, leaving out the trailing blank lines
+// and comments, which belong to what comes next.
+func (e *yamlEditor) regionEnd(start, next int) int {
+	for next-1 > start && isBlankOrComment(e.lines[next-1]) {
+		next--
+	}
+	return next
+}
+
+// headStart returns the line index of the first line of the comments directly
+// above the line.
+func (e *yamlEditor) headStart(line int) int {
+	for line > 0 && strings.HasPrefix(strings.TrimSpace(e.lines[line-1]), "#") {
+		line--
+	}
+	return line
+}
+
+func isBlankOrComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// setValue replaces the value of the entry of the mapping at index i with the
+// given YAML text, which must fit on a single line.
+func (e *yamlEditor) setValue(m *yamlv3.Node, i, parentEnd int, text string) {
+	key, value := m.Content[i], m.Content[i+1]
+	end := e.entryEnd(m, i, parentEnd)
+	if value.Line == key.Line && end == key.Line {
+		line := e.lines[value.Line-1]
+		prefix := line[:byteOffset(line, value.Column)]
+		suffix := ""
+		if value.LineComment != "" {
+			if idx := strings.LastIndex(line, value.LineComment); idx >= len(prefix) {
+				suffix = line[len(strings.TrimRight(line[:idx], " \t")):]
+			}
+		}
+		e.edits = append(e.edits, lineEdit{start: value.Line - 1, end: end, lines: []string{prefix + text + suffix}})
+		return
+	}
+	line := e.lines[key.Line-1]
+	indent := line[:byteOffset(line, key.Column)]
+	e.edits = append(e.edits, lineEdit{start: key.Line - 1, end: end, lines: []string{indent + key.Value + ": " + text}})
+}
+
+// setSequence replaces the value of the entry of the mapping at index i with a
+// sequence of the given scalars, keeping the block or flow style of the
+// existing value.
+func (e *yamlEditor) setSequence(m *yamlv3.Node, i, parentEnd int, items []string) error {
+	key, value := m.Content[i], m.Content[i+1]
+	if value.Kind != yamlv3.SequenceNode || value.Style&yamlv3.FlowStyle != 0 || value.Line == key.Line {
+		text, err := formatFlowSequence(items)
+		if err != nil {
+			return err
+		}
+		e.setValue(m, i, parentEnd, text)
+		return nil
+	}
+	line := e.lines[value.Line-1]
+	indent := line[:byteOffset(line, value.Column)]
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		text, err := formatScalar(item, 0)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, indent+"- "+text)
+	}
+	e.edits = append(e.edits, lineEdit{start: value.Line - 1, end: e.entryEnd(m, i, parentEnd), lines: lines})
+	return nil
+}
+
+// deleteEntry removes the entry of the mapping at index i, with its comments.
+func (e *yamlEditor) deleteEntry(m *yamlv3.Node, i, parentEnd int) {
+	e.delete(e.headStart(m.Content[i].Line-1), e.entryEnd(m, i, parentEnd))
+}
+
+// deleteItem removes the item of the block sequence at index i, with its
+// comments.
+func (e *yamlEditor) deleteItem(s *yamlv3.Node, i, parentEnd int) error {
+	if s.Style&yamlv3.FlowStyle != 0 {
+		return fmt.Errorf("cannot remove an item of the flow sequence at line %d", s.Line)
+	}
+	e.delete(e.headStart(e.itemStart(s.Content[i])), e.itemEnd(s, i, parentEnd))
+	return nil
+}
+
+// delete removes the lines in [start, end), as well as the blank lines after
+// them if they are preceded by a blank line, to not leave two separators.
+func (e *yamlEditor) delete(start, end int) {
+	if start > 0 && strings.TrimSpace(e.lines[start-1]) == "" {
+		for end < len(e.lines) && strings.TrimSpace(e.lines[end]) == "" {
+			end++
+		}
+	}
+	e.edits = append(e.edits, lineEdit{start: start, end: end})
+}
+
+// insert adds the lines before the line index.
+func (e *yamlEditor) insert(line int, lines ...string) {
+	e.edits = append(e.edits, lineEdit{start: line, end: line, lines: lines})
+}
+
+// bytes returns the edited document. The edits must not overlap.
+func (e *yamlEditor) bytes() []byte {
+	edits := append([]lineEdit(nil), e.edits...)
+	// Apply the edits from the bottom up so that the line indexes of the
+	// remaining ones stay valid, with insertions after the replacements
+	// starting at the same line so that they end up above them.
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		}
+		return edits[i].end > edits[j].end
+	})
+	lines := append([]string(nil), e.lines...)
+	for _, ed := range edits {
+		lines = append(lines[:ed.start], append(append([]string(nil), ed.lines...), lines[ed.end:]...)...)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// formatScalar returns the YAML text of the scalar, in the given style if
+// possible.
+func formatScalar(value string, style yamlv3.Style) (string, error) {
+	n := &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: value, Style: style &^ (yamlv3.LiteralStyle | yamlv3.FoldedStyle)}
+	bs, err := yamlv3.Marshal(n)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(bs), "\n"), nil
+}
+
+func formatFlowSequence(items []string) (string, error) {
+	texts := make([]string, 0, len(items))
+	for _, item := range items {
+		text, err := formatScalar(item, 0)
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, text)
+	}
+	return "[" + strings.Join(texts, ", ") + "]", nil
+}
+
+// byteOffset converts the 1-based column of a node, counted in characters, to
+// a byte offset in the line.
+func byteOffset(line string, column int) int {
+	offset := 0
+	for i := 1; i < column && offset < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+	}
+	return offset
+}
@@ -0,0 +1,228 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// BaseField is a field of an effective base config, with the .base.yaml files
+// that set it in overlay order. Only the fields that are appended to, e.g. env
+// and requirements, can come from several files.
+type BaseField struct {
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+	Files []string    `json:"files"`
+}
+
+// readBaseFile reads the .base.yaml file and the config it imports. It also
+// returns the top-level fields as written in the file, to tell the fields set
+// to their zero value from the ones that are not set.
+func readBaseFile(file string) (spec.BaseConfig, map[string]interface{}, error) {
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return spec.BaseConfig{}, nil, fmt.Errorf("failed to read %q: %w", file, err)
+	}
+	baseConfig := spec.BaseConfig{}
+	if err := yaml.UnmarshalStrict(yamlFile, &baseConfig, yaml.DisallowUnknownFields); err != nil {
+		return spec.BaseConfig{}, nil, fmt.Errorf("failed to unmarshal %q: %w", file, err)
+	}
+	if _, err := ParseJobNameTemplate(baseConfig.JobNameTemplate); err != nil {
+		return spec.BaseConfig{}, nil, fmt.Errorf("failed to parse %q: %w", file, err)
+	}
+	baseConfig.CommonConfig, err = resolveImports(file, baseConfig.Imports, baseConfig.CommonConfig)
+	if err != nil {
+		return spec.BaseConfig{}, nil, fmt.Errorf("failed to import in %q: %w", file, err)
+	}
+	fields := map[string]interface{}{}
+	if err := yaml.Unmarshal(yamlFile, &fields); err != nil {
+		return spec.BaseConfig{}, nil, fmt.Errorf("failed to unmarshal %q: %w", file, err)
+	}
+	return baseConfig, fields, nil
+}
+
+// mergeBaseConfig overlays the base config of a .base.yaml file, with the
+// given top-level fields set, on the parent base config:
+//
+//   - the common fields are merged like the ones of the meta config files;
+//   - path_aliases and cluster_overrides are merged by key, the child winning;
+//   - the testgrid_config fields set in the child override the parent ones;
+//   - imports are appended, they are already resolved in the common fields;
+//   - auto_max_procs and job_name_template are overridden if set in the child,
+//     even to their zero value;
+//   - autogen_header cannot be changed, as it tells the files generated by
+//     prowgen from the other ones in the whole output dir.
+func mergeBaseConfig(parent, child spec.BaseConfig, fields map[string]interface{}) (spec.BaseConfig, error) {
+	merged, err := parent.DeepCopy()
+	if err != nil {
+		return spec.BaseConfig{}, err
+	}
+	merged.CommonConfig, err = mergeCommonConfig(merged.CommonConfig, child.CommonConfig)
+	if err != nil {
+		return spec.BaseConfig{}, err
+	}
+	merged.PathAliases = mergeMaps(merged.PathAliases, child.PathAliases)
+	merged.ClusterOverrides = mergeMaps(merged.ClusterOverrides, child.ClusterOverrides)
+	testgridConfig, err := mergeTestgridConfig(&merged.TestgridConfig, &child.TestgridConfig)
+	if err != nil {
+		return spec.BaseConfig{}, err
+	}
+	merged.TestgridConfig = spec.TestgridConfig{}
+	if testgridConfig != nil {
+		merged.TestgridConfig = *testgridConfig
+	}
+	merged.Imports = append(merged.Imports, child.Imports...)
+	if _, ok := fields["auto_max_procs"]; ok {
+		merged.AutoMaxProcs = child.AutoMaxProcs
+	}
+	if _, ok := fields["autogen_header"]; ok {
+		header, parentHeader := child.AutogenHeader, parent.AutogenHeader
+		if header == "" {
+			header = DefaultAutogenHeader
+		}
+		if parentHeader == "" {
+			parentHeader = DefaultAutogenHeader
+		}
+		if header != parentHeader {
+			return spec.BaseConfig{}, fmt.Errorf("%w, got %q instead of %q", ErrNestedAutogenHeader, header, parentHeader)
+		}
+	}
+	if _, ok := fields["job_name_template"]; ok {
+		merged.JobNameTemplate = child.JobNameTemplate
+	}
+	return merged, nil
+}
+
+func mergeMaps(parent, child map[string]string) map[string]string {
+	if len(parent) == 0 && len(child) == 0 {
+		return parent
+	}
+	merged := copyMap(parent)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for k, v := range child {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ExplainBase overlays the .base.yaml files in order, like ReadBase, and
+// returns the effective base config with the files each of its fields comes
+// from. The fields merged by key, e.g. path_aliases or requirement_presets, are
+// listed per key, e.g. path_aliases.istio.
+func ExplainBase(files ...string) (spec.BaseConfig, []BaseField, error) {
+	var baseConfig *spec.BaseConfig
+	sources := map[string]*BaseField{}
+	for _, file := range files {
+		child, fields, err := readBaseFile(file)
+		if err != nil {
+			return spec.BaseConfig{}, nil, err
+		}
+		merged := child
+		if baseConfig != nil {
+			if merged, err = mergeBaseConfig(*baseConfig, child, fields); err != nil {
+				return spec.BaseConfig{}, nil, fmt.Errorf("failed to merge %q: %w", file, err)
+			}
+		}
+		baseConfig = &merged
+
+		// The fields of the imports are only in the resolved config, and
+		// the fields set to their zero value only in the file.
+		resolved, err := baseFields(child)
+		if err != nil {
+			return spec.BaseConfig{}, nil, err
+		}
+		for k, v := range fields {
+			if _, ok := resolved[k]; !ok {
+				resolved[k] = v
+			}
+		}
+		for field, value := range flattenBaseFields(resolved) {
+			source := sources[field]
+			if source == nil {
+				source = &BaseField{Field: field}
+				sources[field] = source
+			}
+			source.Value = value
+			if _, ok := value.([]interface{}); !ok {
+				source.Files = nil
+			}
+			if len(source.Files) == 0 || source.Files[len(source.Files)-1] != file {
+				source.Files = append(source.Files, file)
+			}
+		}
+	}
+	if baseConfig == nil {
+		return spec.BaseConfig{}, []BaseField{}, nil
+	}
+
+	effective, err := baseFields(*baseConfig)
+	if err != nil {
+		return spec.BaseConfig{}, nil, err
+	}
+	flat := flattenBaseFields(effective)
+	result := make([]BaseField, 0, len(sources))
+	for field, source := range sources {
+		if value, ok := flat[field]; ok {
+			source.Value = value
+		} else if strings.Contains(field, ".") {
+			// E.g. testgrid_config.enabled, cleared by disabled.
+			continue
+		}
+		result = append(result, *source)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Field < result[j].Field
+	})
+	return *baseConfig, result, nil
+}
+
+// baseFields returns the top-level fields of the base config, as written in a
+// .base.yaml file.
+func baseFields(baseConfig spec.BaseConfig) (map[string]interface{}, error) {
+	bs, err := yaml.Marshal(baseConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal BaseConfig: %w", err)
+	}
+	fields := map[string]interface{}{}
+	if err := yaml.Unmarshal(bs, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal BaseConfig: %w", err)
+	}
+	return fields, nil
+}
+
+// flattenBaseFields splits the top-level fields merged by key into a field per
+// key. node_selector is replaced as a whole, so it is kept as is.
+func flattenBaseFields(fields map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for field, value := range fields {
+		if m, ok := value.(map[string]interface{}); ok && field != "node_selector" {
+			for k, v := range m {
+				flat[field+"."+k] = v
+			}
+			continue
+		}
+		flat[field] = value
+	}
+	return flat
+}
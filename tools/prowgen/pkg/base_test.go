@@ -0,0 +1,112 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestReadBase(t *testing.T) {
+	root, err := ReadBase(nil, "testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.AutoMaxProcs = true
+	bc, err := ReadBase(&root, "testdata/base/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("# THIS FILE IS AUTOGENERATED. See tools/prowgen/README.md", bc.AutogenHeader); diff != "" {
+		t.Errorf("autogen_header does not match, (-want, +got): \n%s", diff)
+	}
+	if bc.AutoMaxProcs {
+		t.Error("Expected auto_max_procs to be overridden to false")
+	}
+	if diff := cmp.Diff(map[string]string{"istio": "istio.io", "envoyproxy": "github.com/envoyproxy"}, bc.PathAliases); diff != "" {
+		t.Errorf("path_aliases do not match, (-want, +got): \n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"arm64": "base-arm64-cluster"}, bc.ClusterOverrides); diff != "" {
+		t.Errorf("cluster_overrides do not match, (-want, +got): \n%s", diff)
+	}
+	expectedTestgrid := spec.TestgridConfig{Enabled: true, AlertEmail: "base-oncall@googlegroups.com", NumFailuresToAlert: "1"}
+	if diff := cmp.Diff(expectedTestgrid, bc.TestgridConfig); diff != "" {
+		t.Errorf("testgrid_config does not match, (-want, +got): \n%s", diff)
+	}
+	if diff := cmp.Diff([]v1.EnvVar{{Name: "key", Value: "value"}, {Name: "base", Value: "value"}}, bc.Env); diff != "" {
+		t.Errorf("env does not match, (-want, +got): \n%s", diff)
+	}
+	// The root config must be left as is.
+	if len(root.PathAliases) != 1 {
+		t.Errorf("Expected the root path_aliases to be left as is, got %v", root.PathAliases)
+	}
+
+	// The header tells the generated files apart in the whole output dir,
+	// so the sub-folders cannot change it.
+	file := filepath.Join(t.TempDir(), ".base.yaml")
+	if err := os.WriteFile(file, []byte("autogen_header: \"# generated\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBase(&root, file); !errors.Is(err, ErrNestedAutogenHeader) {
+		t.Errorf("Expected %v, got %v", ErrNestedAutogenHeader, err)
+	}
+	// Setting the same header again is allowed.
+	if err := os.WriteFile(file, []byte("autogen_header: \""+root.AutogenHeader+"\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBase(&root, file); err != nil {
+		t.Errorf("Expected the same autogen_header to be allowed, got %v", err)
+	}
+}
+
+func TestExplainBase(t *testing.T) {
+	bc, fields, err := ExplainBase("testdata/.base.yaml", "testdata/base/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.ClusterOverrides["arm64"] != "base-arm64-cluster" {
+		t.Errorf("Expected the overlaid base config, got cluster_overrides %v", bc.ClusterOverrides)
+	}
+
+	sources := map[string][]string{}
+	for _, f := range fields {
+		sources[f.Field] = f.Files
+	}
+	for field, files := range map[string][]string{
+		"auto_max_procs":              {"testdata/base/.base.yaml"},
+		"autogen_header":              {"testdata/.base.yaml"},
+		"path_aliases.istio":          {"testdata/.base.yaml"},
+		"path_aliases.envoyproxy":     {"testdata/base/.base.yaml"},
+		"cluster_overrides.arm64":     {"testdata/base/.base.yaml"},
+		"testgrid_config.enabled":     {"testdata/.base.yaml"},
+		"testgrid_config.alert_email": {"testdata/base/.base.yaml"},
+		"env":                         {"testdata/.base.yaml", "testdata/base/.base.yaml"},
+		"node_selector":               {"testdata/.base.yaml"},
+		"requirement_presets.kind":    {"testdata/.base.yaml"},
+		"resources_presets.default":   {"testdata/.base.yaml"},
+	} {
+		if diff := cmp.Diff(files, sources[field]); diff != "" {
+			t.Errorf("Files of %s do not match, (-want, +got): \n%s", field, diff)
+		}
+	}
+}
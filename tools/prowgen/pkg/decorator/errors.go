@@ -0,0 +1,33 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import "errors"
+
+// Errors returned by the decorators, which can be matched with errors.Is.
+var (
+	ErrUnknownRequirement     = errors.New("unknown requirement")
+	ErrUnknownModifier        = errors.New("unknown modifier")
+	ErrInvalidExpression      = errors.New("invalid expression")
+	ErrUnknownParam           = errors.New("unknown param")
+	ErrUnknownMatrixDimension = errors.New("unknown matrix dimension")
+	// ErrUnknownMatrixCombination is returned for matrix_exclude entries that
+	// do not match any combination of the matrix.
+	ErrUnknownMatrixCombination = errors.New("unknown matrix combination")
+	ErrUnknownResource          = errors.New("unknown resource")
+	ErrInvalidResourceOverride  = errors.New("invalid resource override")
+	ErrInvalidSecrets           = errors.New("invalid secrets")
+	ErrInvalidSelector          = errors.New("invalid requirement selector")
+)
@@ -0,0 +1,342 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Built-in variables, which are always available to the jobs. They are
+// namespaced like the params and matrix variables, so that they cannot be
+// mistaken for shell command substitutions, e.g. $(branch) in a command.
+const (
+	VariableBranch = builtinPrefix + "branch"
+	VariableOrg    = builtinPrefix + "org"
+	VariableRepo   = builtinPrefix + "repo"
+
+	builtinPrefix = "prowgen."
+)
+
+var (
+	builtinVariables = sets.NewString(VariableBranch, VariableOrg, VariableRepo)
+
+	variableNameRegex = regexp.MustCompile(`^[_a-zA-Z0-9.-]+$`)
+
+	// functions that can be applied to the variables, e.g. $(prowgen.branch | replace "." "-").
+	expressionFuncs = map[string]struct {
+		args int
+		fn   func(val string, args []string) string
+	}{
+		"lower": {0, func(val string, _ []string) string { return strings.ToLower(val) }},
+		"upper": {0, func(val string, _ []string) string { return strings.ToUpper(val) }},
+		"replace": {2, func(val string, args []string) string {
+			return strings.ReplaceAll(val, args[0], args[1])
+		}},
+		"trimPrefix": {1, func(val string, args []string) string { return strings.TrimPrefix(val, args[0]) }},
+		"trimSuffix": {1, func(val string, args []string) string { return strings.TrimSuffix(val, args[0]) }},
+	}
+)
+
+// expression is a parsed $(variable:-default | function args...) expression.
+type expression struct {
+	// text is the expression between the $( and ) delimiters.
+	text     string
+	variable string
+	def      *string
+	funcs    []funcCall
+}
+
+type funcCall struct {
+	name string
+	args []string
+}
+
+// span is the position of a $(...) expression in a string, including the
+// delimiters.
+type span struct {
+	start, end int
+}
+
+func (s span) text(str string) string {
+	return str[s.start+2 : s.end-1]
+}
+
+// findExpressions returns the positions of the $(...) expressions in the
+// string. Parentheses in quoted strings are ignored when looking for the end of
+// an expression.
+func findExpressions(str string) []span {
+	var spans []span
+	for i := 0; i+1 < len(str); i++ {
+		if str[i] != '$' || str[i+1] != '(' {
+			continue
+		}
+		depth, quoted := 0, false
+		for j := i + 2; j < len(str); j++ {
+			switch c := str[j]; {
+			case quoted && c == '\\':
+				j++
+			case c == '"':
+				quoted = !quoted
+			case quoted:
+			case c == '(':
+				depth++
+			case c == ')' && depth > 0:
+				depth--
+			case c == ')':
+				spans = append(spans, span{i, j + 1})
+				i = j
+				j = len(str)
+			}
+		}
+	}
+	return spans
+}
+
+// parseExpression parses the text of an expression. It returns false if the
+// expression does not reference a params, matrix or built-in variable, e.g.
+// for shell command substitutions, which must be left as is.
+func parseExpression(text string) (expression, bool, error) {
+	segments := splitOutsideQuotes(text, '|')
+	exp := expression{text: text}
+	variable, def, hasDefault := strings.Cut(strings.TrimSpace(segments[0]), ":-")
+	variable = strings.TrimSpace(variable)
+	if !variableNameRegex.MatchString(variable) || !isKnownVariable(variable) {
+		return exp, false, nil
+	}
+	exp.variable = variable
+	if hasDefault {
+		d, err := unquote(strings.TrimSpace(def))
+		if err != nil {
+			return exp, true, fmt.Errorf("%w $(%s): invalid default: %v", ErrInvalidExpression, text, err)
+		}
+		exp.def = &d
+	}
+
+	for _, segment := range segments[1:] {
+		words, err := splitWords(segment)
+		if err != nil {
+			return exp, true, fmt.Errorf("%w $(%s): %v", ErrInvalidExpression, text, err)
+		}
+		if len(words) == 0 {
+			return exp, true, fmt.Errorf("%w $(%s): missing function after |", ErrInvalidExpression, text)
+		}
+		f, ok := expressionFuncs[words[0]]
+		if !ok {
+			return exp, true, fmt.Errorf("%w $(%s): unknown function %q, must be one of %v",
+				ErrInvalidExpression, text, words[0], sets.StringKeySet(expressionFuncs).List())
+		}
+		if len(words)-1 != f.args {
+			return exp, true, fmt.Errorf("%w $(%s): function %q takes %d argument(s), got %d",
+				ErrInvalidExpression, text, words[0], f.args, len(words)-1)
+		}
+		exp.funcs = append(exp.funcs, funcCall{name: words[0], args: words[1:]})
+	}
+	return exp, true, nil
+}
+
+func isKnownVariable(variable string) bool {
+	return strings.HasPrefix(variable, paramsPrefix) ||
+		strings.HasPrefix(variable, matrixPrefix) ||
+		builtinVariables.Has(variable)
+}
+
+// evaluate resolves the variable with the lookup function, falling back to
+// the default value, and applies the functions to it.
+func (e expression) evaluate(lookup func(variable string) (string, bool)) (string, error) {
+	val, ok := lookup(e.variable)
+	if !ok {
+		if e.def == nil {
+			return "", unknownVariableError(e.variable)
+		}
+		val = *e.def
+	}
+	for _, f := range e.funcs {
+		val = expressionFuncs[f.name].fn(val, f.args)
+	}
+	return val, nil
+}
+
+func unknownVariableError(variable string) error {
+	if strings.HasPrefix(variable, matrixPrefix) {
+		return fmt.Errorf("%w %q, not configured in the matrix", ErrUnknownMatrixDimension, strings.TrimPrefix(variable, matrixPrefix))
+	}
+	return fmt.Errorf("%w %q, not configured in the params map", ErrUnknownParam, strings.TrimPrefix(variable, paramsPrefix))
+}
+
+// substitute replaces all the known expressions in the string with their
+// evaluated value.
+func substitute(str string, lookup func(variable string) (string, bool)) (string, error) {
+	spans := findExpressions(str)
+	if len(spans) == 0 {
+		return str, nil
+	}
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		exp, ok, err := parseExpression(s.text(str))
+		if err != nil {
+			return "", err
+		}
+		var val string
+		if ok {
+			val, err = exp.evaluate(lookup)
+		} else {
+			// Unknown expressions are kept, but can contain known ones, e.g.
+			// $(echo $(params.key)).
+			val, err = substitute(s.text(str), lookup)
+			val = "$(" + val + ")"
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(str[last:s.start])
+		sb.WriteString(val)
+		last = s.end
+	}
+	sb.WriteString(str[last:])
+	return sb.String(), nil
+}
+
+// collectExpressions returns the known expressions of all the strings in the
+// object, in the order they appear in its YAML form and without duplicates.
+func collectExpressions(obj interface{}) ([]expression, error) {
+	var exps []expression
+	seen := sets.NewString()
+	var err error
+	var collect func(str string)
+	collect = func(str string) {
+		for _, s := range findExpressions(str) {
+			text := s.text(str)
+			if seen.Has(text) || err != nil {
+				continue
+			}
+			exp, ok, e := parseExpression(text)
+			switch {
+			case e != nil:
+				err = e
+			case ok:
+				seen.Insert(text)
+				exps = append(exps, exp)
+			default:
+				collect(text)
+			}
+		}
+	}
+	walkStrings(obj, collect)
+	return exps, err
+}
+
+// walkStrings calls fn for each map key and string value of the object, with
+// the map keys sorted like in the YAML form of the object.
+func walkStrings(obj interface{}, fn func(string)) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fn(k)
+			walkStrings(o[k], fn)
+		}
+	case []interface{}:
+		for _, v := range o {
+			walkStrings(v, fn)
+		}
+	case string:
+		fn(o)
+	}
+}
+
+// substituteStrings returns a copy of the object with fn applied to all the
+// map keys and string values.
+func substituteStrings(obj interface{}, fn func(string) (string, error)) (interface{}, error) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			key, err := fn(k)
+			if err != nil {
+				return nil, err
+			}
+			if res[key], err = substituteStrings(v, fn); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, len(o))
+		for i, v := range o {
+			var err error
+			if res[i], err = substituteStrings(v, fn); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case string:
+		return fn(o)
+	}
+	return obj, nil
+}
+
+// splitOutsideQuotes splits the string on sep, ignoring the separators in
+// quoted strings.
+func splitOutsideQuotes(str string, sep byte) []string {
+	var res []string
+	quoted, last := false, 0
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			res = append(res, str[last:i])
+			last = i + 1
+		}
+	}
+	return append(res, str[last:])
+}
+
+// splitWords splits a function call into its name and arguments, which are
+// separated by spaces and can be quoted with Go string syntax.
+func splitWords(str string) ([]string, error) {
+	var words []string
+	for _, w := range splitOutsideQuotes(strings.TrimSpace(str), ' ') {
+		if w == "" {
+			continue
+		}
+		word, err := unquote(w)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+func unquote(str string) (string, error) {
+	if strings.HasPrefix(str, `"`) {
+		return strconv.Unquote(str)
+	}
+	return str, nil
+}
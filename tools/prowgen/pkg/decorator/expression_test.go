@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubstitute(t *testing.T) {
+	vars := map[string]string{
+		"params.name":   "Foo",
+		"params.colon":  "a: b # c",
+		"matrix.k8s":    "1.30",
+		VariableBranch:  "release-1.20",
+		VariableRepo:    "istio",
+		VariableOrg:     "istio",
+		"params.quoted": `"x"`,
+	}
+	lookup := func(variable string) (string, bool) {
+		val, ok := vars[variable]
+		return val, ok
+	}
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{in: "plain", want: "plain"},
+		{in: "$(params.name)", want: "Foo"},
+		{in: "$(params.colon)", want: "a: b # c"},
+		{in: "$(params.quoted)", want: `"x"`},
+		{in: "k8s-$(matrix.k8s)", want: "k8s-1.30"},
+		{in: "$(prowgen.org)/$(prowgen.repo)@$(prowgen.branch)", want: "istio/istio@release-1.20"},
+		{in: "$(params.missing:-fallback)", want: "fallback"},
+		{in: "$(params.missing:-)", want: ""},
+		{in: `$(params.missing:-"a | b")`, want: "a | b"},
+		{in: "$(params.name:-fallback)", want: "Foo"},
+		{in: "$(params.name | lower)", want: "foo"},
+		{in: "$(params.name|upper)", want: "FOO"},
+		{in: `$(prowgen.branch | trimPrefix "release-" | replace "." "-")`, want: "1-20"},
+		{in: `$(prowgen.branch | trimSuffix ".20")`, want: "release-1"},
+		{in: `$(params.missing:-A.B | lower | replace . _)`, want: "a_b"},
+		// shell substitutions are left as is
+		{in: "$(pwd)/$(git rev-parse HEAD)", want: "$(pwd)/$(git rev-parse HEAD)"},
+		{in: "git checkout $(branch) && echo $(org)/$(repo)", want: "git checkout $(branch) && echo $(org)/$(repo)"},
+		{in: "echo $(echo $(params.name) $(pwd))", want: "echo $(echo Foo $(pwd))"},
+		{in: "$(params.name", want: "$(params.name"},
+		{in: "$(params.missing)", err: ErrUnknownParam},
+		{in: "$(matrix.missing)", err: ErrUnknownMatrixDimension},
+		{in: "$(params.name | title)", err: ErrInvalidExpression},
+		{in: "$(params.name | replace a)", err: ErrInvalidExpression},
+		{in: "$(params.name |)", err: ErrInvalidExpression},
+	}
+	for _, tt := range tests {
+		got, err := substitute(tt.in, lookup)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%q: expected error %v, got %v", tt.in, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -21,9 +21,12 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
-func validate(input string, options sets.String, description string) error {
+const typePeriodic = "periodic"
+
+// validate returns an error wrapping kind if the input is not one of the options.
+func validate(input string, options sets.String, description string, kind error) error {
 	if !options.Has(input) {
-		return fmt.Errorf("'%v' is not a valid %v. Must be one of %v", input, description, strings.Join(options.List(), ", "))
+		return fmt.Errorf("%w '%v' in %v, must be one of %v", kind, input, description, strings.Join(options.List(), ", "))
 	}
 	return nil
 }
@@ -15,53 +15,333 @@
 package decorator
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"sync"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	prowjob "sigs.k8s.io/prow/pkg/apis/prowjobs/v1"
 	"sigs.k8s.io/prow/pkg/config"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
 )
 
 const (
 	ModifierHidden            = "hidden"
 	ModifierPresubmitOptional = "presubmit_optional"
 	ModifierPresubmitSkipped  = "presubmit_skipped"
+	// ModifierPaused replaces the cron and interval of the periodics with
+	// pausedCron, which never fires, as Prow rejects periodics without a
+	// schedule. They can still be triggered manually.
+	ModifierPaused              = "paused"
+	ModifierReportOnFailureOnly = "report_on_failure_only"
+
+	// pausedCron is a valid cron string that never fires, since February 31st
+	// does not exist. Prow requires periodics to have a schedule, so it is used
+	// instead of removing the schedule of paused periodics.
+	pausedCron = "0 0 31 2 *"
+)
+
+// Modifier changes the generated Prow jobs of the jobs that list it in their
+// modifiers.
+type Modifier interface {
+	// Name is the name used to reference the modifier in the job modifiers.
+	Name() string
+	// Validate returns an error if the modifier cannot be applied to the job.
+	Validate(job spec.Job) error
+	ApplyPresubmit(presubmit *config.Presubmit) error
+	ApplyPostsubmit(postsubmit *config.Postsubmit) error
+	ApplyPeriodic(periodic *config.Periodic) error
+}
+
+// ModifierFuncs implements a Modifier with functions, any of which can be left
+// nil if the modifier has no effect on that job type or needs no validation.
+type ModifierFuncs struct {
+	ModifierName string
+	ValidateJob  func(job spec.Job) error
+	Presubmit    func(presubmit *config.Presubmit) error
+	Postsubmit   func(postsubmit *config.Postsubmit) error
+	Periodic     func(periodic *config.Periodic) error
+}
+
+func (m ModifierFuncs) Name() string {
+	return m.ModifierName
+}
+
+func (m ModifierFuncs) Validate(job spec.Job) error {
+	if m.ValidateJob == nil {
+		return nil
+	}
+	return m.ValidateJob(job)
+}
+
+func (m ModifierFuncs) ApplyPresubmit(presubmit *config.Presubmit) error {
+	if m.Presubmit == nil {
+		return nil
+	}
+	return m.Presubmit(presubmit)
+}
+
+func (m ModifierFuncs) ApplyPostsubmit(postsubmit *config.Postsubmit) error {
+	if m.Postsubmit == nil {
+		return nil
+	}
+	return m.Postsubmit(postsubmit)
+}
+
+func (m ModifierFuncs) ApplyPeriodic(periodic *config.Periodic) error {
+	if m.Periodic == nil {
+		return nil
+	}
+	return m.Periodic(periodic)
+}
+
+var (
+	modifiersMu sync.RWMutex
+	modifiers   = map[string]Modifier{}
 )
 
-func ApplyModifiersPresubmit(presubmit *config.Presubmit, jobModifiers []string) {
-	for _, modifier := range jobModifiers {
-		switch modifier {
-		case ModifierPresubmitOptional:
-			presubmit.Optional = true
-		case ModifierHidden:
-			presubmit.SkipReport = true
-			presubmit.ReporterConfig = &prowjob.ReporterConfig{
-				Slack: &prowjob.SlackReporterConfig{
-					JobStatesToReport: []prowjob.ProwJobState{},
-				},
-			}
-		case ModifierPresubmitSkipped:
-			presubmit.AlwaysRun = false
-		default:
-			log.Fatalf("Modifier %q is not unsupported for %v", modifier, presubmit.Name)
+func init() {
+	for _, m := range []Modifier{
+		ModifierFuncs{
+			ModifierName: ModifierPresubmitOptional,
+			Presubmit: func(presubmit *config.Presubmit) error {
+				presubmit.Optional = true
+				return nil
+			},
+		},
+		ModifierFuncs{
+			ModifierName: ModifierHidden,
+			Presubmit: func(presubmit *config.Presubmit) error {
+				presubmit.SkipReport = true
+				presubmit.ReporterConfig = &prowjob.ReporterConfig{
+					Slack: &prowjob.SlackReporterConfig{
+						JobStatesToReport: []prowjob.ProwJobState{},
+					},
+				}
+				return nil
+			},
+			Postsubmit: func(postsubmit *config.Postsubmit) error {
+				postsubmit.SkipReport = true
+				f := false
+				postsubmit.ReporterConfig = &prowjob.ReporterConfig{
+					Slack: &prowjob.SlackReporterConfig{
+						Report: &f,
+					},
+				}
+				return nil
+			},
+			Periodic: func(periodic *config.Periodic) error {
+				f := false
+				periodic.ReporterConfig = &prowjob.ReporterConfig{
+					Slack: &prowjob.SlackReporterConfig{
+						Report: &f,
+					},
+				}
+				return nil
+			},
+		},
+		ModifierFuncs{
+			ModifierName: ModifierPresubmitSkipped,
+			Presubmit: func(presubmit *config.Presubmit) error {
+				presubmit.AlwaysRun = false
+				return nil
+			},
+		},
+		ModifierFuncs{
+			ModifierName: ModifierPaused,
+			ValidateJob:  validatePeriodicOnly(ModifierPaused),
+			Periodic: func(periodic *config.Periodic) error {
+				// The job is still generated so that it can be triggered manually.
+				periodic.Cron = pausedCron
+				periodic.Interval = ""
+				return nil
+			},
+		},
+		ModifierFuncs{
+			ModifierName: ModifierReportOnFailureOnly,
+			ValidateJob:  validatePeriodicOnly(ModifierReportOnFailureOnly),
+			Periodic: func(periodic *config.Periodic) error {
+				if periodic.ReporterConfig == nil {
+					periodic.ReporterConfig = &prowjob.ReporterConfig{}
+				}
+				if periodic.ReporterConfig.Slack == nil {
+					periodic.ReporterConfig.Slack = &prowjob.SlackReporterConfig{}
+				}
+				periodic.ReporterConfig.Slack.JobStatesToReport = []prowjob.ProwJobState{prowjob.FailureState, prowjob.ErrorState}
+				return nil
+			},
+		},
+	} {
+		if err := RegisterModifier(m); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// validatePeriodicOnly rejects jobs that do not generate a periodic, for the
+// modifiers that only apply to periodics.
+func validatePeriodicOnly(name string) func(job spec.Job) error {
+	return func(job spec.Job) error {
+		if !sets.NewString(job.Types...).Has(typePeriodic) {
+			return fmt.Errorf("%s only applies to periodic jobs", name)
+		}
+		return nil
+	}
+}
+
+// RegisterModifier registers the modifier so that jobs can reference it by
+// name. It returns an error if a modifier with the same name is already
+// registered.
+func RegisterModifier(m Modifier) error {
+	modifiersMu.Lock()
+	defer modifiersMu.Unlock()
+	if _, f := modifiers[m.Name()]; f {
+		return fmt.Errorf("modifier %q is already registered", m.Name())
+	}
+	modifiers[m.Name()] = m
+	return nil
+}
+
+// LookupModifier returns the modifier with the given name, either declared in
+// the presets or registered with RegisterModifier.
+func LookupModifier(name string, presets map[string]spec.ModifierPreset) (Modifier, error) {
+	modifiersMu.RLock()
+	m, registered := modifiers[name]
+	modifiersMu.RUnlock()
+	preset, declared := presets[name]
+	switch {
+	case registered && declared:
+		return nil, fmt.Errorf("modifier preset %q conflicts with the registered modifier with the same name", name)
+	case registered:
+		return m, nil
+	case declared:
+		return presetModifier{name: name, preset: preset}, nil
+	}
+
+	options := sets.StringKeySet(presets)
+	modifiersMu.RLock()
+	for n := range modifiers {
+		options.Insert(n)
+	}
+	modifiersMu.RUnlock()
+	return nil, validate(name, options, "modifiers", ErrUnknownModifier)
+}
+
+// ValidateModifier returns an error if the modifier is unknown.
+func ValidateModifier(modifier string, presets map[string]spec.ModifierPreset) error {
+	_, err := LookupModifier(modifier, presets)
+	return err
+}
+
+func ApplyModifiersPresubmit(presubmit *config.Presubmit, jobModifiers []string, presets map[string]spec.ModifierPreset) error {
+	for _, name := range jobModifiers {
+		m, err := LookupModifier(name, presets)
+		if err != nil {
+			return fmt.Errorf("%v: %w", presubmit.Name, err)
+		}
+		if err := m.ApplyPresubmit(presubmit); err != nil {
+			return fmt.Errorf("%v: failed to apply modifier %q: %w", presubmit.Name, name, err)
+		}
+	}
+	return nil
+}
+
+func ApplyModifiersPostsubmit(postsubmit *config.Postsubmit, jobModifiers []string, presets map[string]spec.ModifierPreset) error {
+	for _, name := range jobModifiers {
+		m, err := LookupModifier(name, presets)
+		if err != nil {
+			return fmt.Errorf("%v: %w", postsubmit.Name, err)
 		}
+		if err := m.ApplyPostsubmit(postsubmit); err != nil {
+			return fmt.Errorf("%v: failed to apply modifier %q: %w", postsubmit.Name, name, err)
+		}
+	}
+	return nil
+}
+
+func ApplyModifiersPeriodic(periodic *config.Periodic, jobModifiers []string, presets map[string]spec.ModifierPreset) error {
+	for _, name := range jobModifiers {
+		m, err := LookupModifier(name, presets)
+		if err != nil {
+			return fmt.Errorf("%v: %w", periodic.Name, err)
+		}
+		if err := m.ApplyPeriodic(periodic); err != nil {
+			return fmt.Errorf("%v: failed to apply modifier %q: %w", periodic.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// presetModifier is a modifier declared in the modifier_presets, which merges
+// the patch for each job type into the generated Prow job.
+type presetModifier struct {
+	name   string
+	preset spec.ModifierPreset
+}
+
+func (m presetModifier) Name() string {
+	return m.name
+}
+
+func (m presetModifier) Validate(spec.Job) error {
+	return nil
+}
+
+func (m presetModifier) ApplyPresubmit(presubmit *config.Presubmit) error {
+	return mergePatch(presubmit, m.preset.Presubmit)
+}
+
+func (m presetModifier) ApplyPostsubmit(postsubmit *config.Postsubmit) error {
+	return mergePatch(postsubmit, m.preset.Postsubmit)
+}
+
+func (m presetModifier) ApplyPeriodic(periodic *config.Periodic) error {
+	return mergePatch(periodic, m.preset.Periodic)
+}
+
+// mergePatch applies the patch to the job with the JSON merge patch semantics
+// (RFC 7386): objects are merged recursively, null values remove the field and
+// any other value replaces it.
+func mergePatch[T any](job *T, patch map[string]interface{}) error {
+	if len(patch) == 0 {
+		return nil
+	}
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(bs, &obj); err != nil {
+		return err
 	}
+	if bs, err = json.Marshal(mergeObjects(obj, patch)); err != nil {
+		return err
+	}
+	var patched T
+	if err := json.Unmarshal(bs, &patched); err != nil {
+		return err
+	}
+	*job = patched
+	return nil
 }
 
-func ApplyModifiersPostsubmit(postsubmit *config.Postsubmit, jobModifiers []string) {
-	for _, modifier := range jobModifiers {
-		switch modifier {
-		case ModifierPresubmitOptional, ModifierPresubmitSkipped:
-			// No effect on postsubmit
-		case ModifierHidden:
-			postsubmit.SkipReport = true
-			f := false
-			postsubmit.ReporterConfig = &prowjob.ReporterConfig{
-				Slack: &prowjob.SlackReporterConfig{
-					Report: &f,
-				},
-			}
-		default:
-			log.Fatalf("Modifier %q is not unsupported for %v", modifier, postsubmit.Name)
+func mergeObjects(obj, patch map[string]interface{}) map[string]interface{} {
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(obj, k)
+			continue
+		}
+		vp, isObj := v.(map[string]interface{})
+		if !isObj {
+			obj[k] = v
+			continue
 		}
+		vo, _ := obj[k].(map[string]interface{})
+		obj[k] = mergeObjects(vo, vp)
 	}
+	return obj
 }
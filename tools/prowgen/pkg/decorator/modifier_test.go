@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/robfig/cron.v2"
+	"sigs.k8s.io/prow/pkg/config"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestRegisterModifier(t *testing.T) {
+	m := ModifierFuncs{
+		ModifierName: "test_max_concurrency_one",
+		ValidateJob: func(job spec.Job) error {
+			if job.MaxConcurrency > 1 {
+				return errors.New("max_concurrency is already set")
+			}
+			return nil
+		},
+		Periodic: func(periodic *config.Periodic) error {
+			periodic.MaxConcurrency = 1
+			return nil
+		},
+	}
+	if err := RegisterModifier(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterModifier(m); err == nil {
+		t.Fatal("Expected an error when registering the same modifier twice")
+	}
+
+	mod, err := LookupModifier(m.Name(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mod.Validate(spec.Job{CommonConfig: spec.CommonConfig{MaxConcurrency: 2}}); err == nil {
+		t.Fatal("Expected the job to be rejected by the modifier")
+	}
+
+	periodic := config.Periodic{}
+	if err := ApplyModifiersPeriodic(&periodic, []string{m.Name()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if periodic.MaxConcurrency != 1 {
+		t.Fatalf("Expected max_concurrency to be set by the modifier, got %d", periodic.MaxConcurrency)
+	}
+	presubmit := config.Presubmit{}
+	if err := ApplyModifiersPresubmit(&presubmit, []string{m.Name()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if presubmit.MaxConcurrency != 0 {
+		t.Fatalf("Expected presubmits to be left unchanged, got max_concurrency %d", presubmit.MaxConcurrency)
+	}
+
+	_, err = LookupModifier(m.Name(), map[string]spec.ModifierPreset{m.Name(): {}})
+	if err == nil {
+		t.Fatal("Expected an error for a modifier preset conflicting with a registered modifier")
+	}
+	if err := ApplyModifiersPresubmit(&presubmit, []string{"unknown"}, nil); !errors.Is(err, ErrUnknownModifier) {
+		t.Fatalf("Expected ErrUnknownModifier, got %v", err)
+	}
+}
+
+func TestPeriodicOnlyModifiers(t *testing.T) {
+	for _, name := range []string{ModifierPaused, ModifierReportOnFailureOnly} {
+		m, err := LookupModifier(name, nil)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		if err := m.Validate(spec.Job{Types: []string{"presubmit", "postsubmit"}}); err == nil {
+			t.Errorf("%s: expected an error for a job without periodic", name)
+		}
+		if err := m.Validate(spec.Job{Types: []string{"presubmit", "periodic"}}); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	periodic := &config.Periodic{Interval: "1h"}
+	if err := ApplyModifiersPeriodic(periodic, []string{ModifierPaused}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if periodic.Interval != "" || periodic.Cron != pausedCron {
+		t.Errorf("paused periodic still scheduled: cron %q, interval %q", periodic.Cron, periodic.Interval)
+	}
+}
+
+func TestPausedCron(t *testing.T) {
+	// Prow parses the cron of the periodics with robfig/cron, whose Next
+	// returns the zero time for a schedule that never fires.
+	schedule, err := cron.Parse(pausedCron)
+	if err != nil {
+		t.Fatalf("Prow rejects the cron of the paused periodics: %v", err)
+	}
+	for _, from := range []time.Time{time.Now(), time.Date(2028, time.February, 1, 0, 0, 0, 0, time.UTC)} {
+		if next := schedule.Next(from); !next.IsZero() {
+			t.Errorf("Expected the paused periodics to never be scheduled, got %v from %v", next, from)
+		}
+	}
+}
@@ -16,8 +16,9 @@ package decorator
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"math"
+	"regexp"
 	"strconv"
 
 	"github.com/hashicorp/go-multierror"
@@ -29,7 +30,31 @@ import (
 	"istio.io/test-infra/tools/prowgen/pkg/spec"
 )
 
-func ApplyRequirements(baseConfig spec.BaseConfig, job *config.JobBase, requirements, excludedRequirements []string, presetMap map[string]spec.RequirementPreset) {
+func ApplyRequirements(baseConfig spec.BaseConfig, job *config.JobBase, requirements, excludedRequirements []string, presetMap map[string]spec.RequirementPreset) error {
+	if err := ValidateRequirements(requirements, excludedRequirements, presetMap); err != nil {
+		return fmt.Errorf("requirements validation failed: %w", err)
+	}
+
+	blocked := sets.NewString(excludedRequirements...)
+	presets := make([]spec.RequirementPreset, 0)
+	for _, req := range requirements {
+		if !blocked.Has(req) {
+			presets = append(presets, presetMap[req])
+		}
+	}
+	if err := resolveRequirements(job.Annotations, job.Labels, job.Spec, presets); err != nil {
+		return err
+	}
+	if err := applySecrets(job, presets); err != nil {
+		return err
+	}
+	applyAutoMaxProcs(baseConfig, job)
+	return nil
+}
+
+// ValidateRequirements returns an error for each of the requirements and
+// excluded requirements that is not defined in the presetMap.
+func ValidateRequirements(requirements, excludedRequirements []string, presetMap map[string]spec.RequirementPreset) error {
 	validRequirements := sets.NewString()
 	for name := range presetMap {
 		validRequirements = validRequirements.Insert(name)
@@ -39,7 +64,8 @@ func ApplyRequirements(baseConfig spec.BaseConfig, job *config.JobBase, requirem
 		if e := validate(
 			req,
 			validRequirements,
-			"requirements"); e != nil {
+			"requirements",
+			ErrUnknownRequirement); e != nil {
 			err = multierror.Append(err, e)
 		}
 	}
@@ -47,24 +73,79 @@ func ApplyRequirements(baseConfig spec.BaseConfig, job *config.JobBase, requirem
 		if e := validate(
 			req,
 			validRequirements,
-			"excluded_requirements"); e != nil {
+			"excluded_requirements",
+			ErrUnknownRequirement); e != nil {
 			err = multierror.Append(err, e)
 		}
 	}
-	if err != nil {
-		log.Fatalf("Requirements validation failed: %v", err)
-	}
+	return err
+}
 
-	blocked := sets.NewString(excludedRequirements...)
-	presets := make([]spec.RequirementPreset, 0)
+// SelectRequirements returns the names of the requirements that apply to a
+// generated Prow job of the given type, branch and architecture.
+func SelectRequirements(requirements []spec.Requirement, jobType, branch, arch string) ([]string, error) {
+	var names []string
 	for _, req := range requirements {
-		if !blocked.Has(req) {
-			presets = append(presets, presetMap[req])
+		if req.When != nil {
+			match, err := matchSelector(*req.When, jobType, branch, arch)
+			if err != nil {
+				return nil, fmt.Errorf("requirement %q: %w", req.Name, err)
+			}
+			if !match {
+				continue
+			}
 		}
+		names = append(names, req.Name)
 	}
-	resolveRequirements(job.Annotations, job.Labels, job.Spec, presets)
-	applySecrets(job, presets)
-	applyAutoMaxProcs(baseConfig, job)
+	return names, nil
+}
+
+// ValidateRequirementSelector returns an error if the selector has an invalid
+// job type, architecture or branch regex.
+func ValidateRequirementSelector(selector spec.RequirementSelector, types, arches sets.String) error {
+	var err error
+	for _, t := range selector.Types {
+		if e := validate(t, types, "when.types", ErrInvalidSelector); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+	for _, a := range selector.Arch {
+		if e := validate(a, arches, "when.arch", ErrInvalidSelector); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+	for _, b := range selector.Branches {
+		if _, e := branchRegexp(b); e != nil {
+			err = multierror.Append(err, fmt.Errorf("%w: branch %q in when.branches: %v", ErrInvalidSelector, b, e))
+		}
+	}
+	return err
+}
+
+func matchSelector(selector spec.RequirementSelector, jobType, branch, arch string) (bool, error) {
+	if len(selector.Types) > 0 && !sets.NewString(selector.Types...).Has(jobType) {
+		return false, nil
+	}
+	if len(selector.Arch) > 0 && !sets.NewString(selector.Arch...).Has(arch) {
+		return false, nil
+	}
+	if len(selector.Branches) == 0 {
+		return true, nil
+	}
+	for _, b := range selector.Branches {
+		re, err := branchRegexp(b)
+		if err != nil {
+			return false, fmt.Errorf("%w: branch %q: %v", ErrInvalidSelector, b, err)
+		}
+		if re.MatchString(branch) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func branchRegexp(branch string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + branch + ")$")
 }
 
 // With a big node and low CPU limit, go will spawn a thread per node core. This can lead to bad performance.
@@ -81,40 +162,44 @@ func applyAutoMaxProcs(baseConfig spec.BaseConfig, job *config.JobBase) {
 	}
 }
 
-func applySecrets(job *config.JobBase, presets []spec.RequirementPreset) {
+func applySecrets(job *config.JobBase, presets []spec.RequirementPreset) error {
 	secrets := []spec.Secret{}
 	for _, req := range presets {
 		secrets = append(secrets, req.Secrets...)
 	}
 	if len(secrets) == 0 {
-		return
+		return nil
 	}
 	marshal, err := json.Marshal(secrets)
 	if err != nil {
-		log.Fatalf("failed to marshal secrets: %v", err)
+		return fmt.Errorf("failed to marshal secrets: %w", err)
 	}
 	if len(job.Spec.Containers) != 1 {
 		// We could support more but it may expand permissions, just keep it safe for now
-		log.Fatalf("secrets only work with 1 container")
+		return fmt.Errorf("%w: secrets only work with 1 container", ErrInvalidSecrets)
 	}
 	job.Spec.Containers[0].Env = append(job.Spec.Containers[0].Env, v1.EnvVar{
 		Name:  "GCP_SECRETS",
 		Value: string(marshal),
 	})
+	return nil
 }
 
-func resolveRequirements(annotations, labels map[string]string, spec *v1.PodSpec, requirements []spec.RequirementPreset) {
+func resolveRequirements(annotations, labels map[string]string, spec *v1.PodSpec, requirements []spec.RequirementPreset) error {
 	if spec != nil {
 		for _, req := range requirements {
-			mergeRequirement(annotations, labels, spec, spec.Containers, &spec.Volumes, req)
+			if err := mergeRequirement(annotations, labels, spec, spec.Containers, &spec.Volumes, req); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
 // mergeRequirement will overlay the requirement on the existing job spec. Use mergo for all keys except containers and metadata
 func mergeRequirement(annotations, labels map[string]string, spec *v1.PodSpec, containers []v1.Container, volumes *[]v1.Volume,
 	req spec.RequirementPreset,
-) {
+) error {
 	for a, v := range req.Annotations {
 		annotations[a] = v
 	}
@@ -167,7 +252,8 @@ func mergeRequirement(annotations, labels map[string]string, spec *v1.PodSpec, c
 
 	if req.PodSpec != nil {
 		if err := mergo.Merge(spec, req.PodSpec); err != nil {
-			log.Fatalf("Unable to merge PodSpec: %v", err)
+			return fmt.Errorf("unable to merge PodSpec: %w", err)
 		}
 	}
+	return nil
 }
@@ -0,0 +1,90 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestSelectRequirements(t *testing.T) {
+	var reqs []spec.Requirement
+	if err := yaml.Unmarshal([]byte(`
+- docker
+- name: gcp
+  when: {types: [postsubmit], branches: ["release-.*"], arch: [arm64]}
+- name: github
+  when: {branches: [master, experimental]}
+`), &reqs); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		jobType, branch, arch string
+		want                  []string
+	}{
+		{"presubmit", "master", "amd64", []string{"docker", "github"}},
+		{"postsubmit", "master", "arm64", []string{"docker", "github"}},
+		{"postsubmit", "release-1.20", "arm64", []string{"docker", "gcp"}},
+		{"postsubmit", "release-1.20", "amd64", []string{"docker"}},
+		{"presubmit", "release-1.20", "arm64", []string{"docker"}},
+		{"periodic", "experimental-foo", "amd64", []string{"docker"}},
+	}
+	for _, tt := range tests {
+		got, err := SelectRequirements(reqs, tt.jobType, tt.branch, tt.arch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s/%s/%s: (-want, +got): %s", tt.jobType, tt.branch, tt.arch, diff)
+		}
+	}
+
+	// Plain requirements are marshaled back to their short form.
+	bs, err := yaml.Marshal(reqs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "- docker\n" {
+		t.Errorf("unexpected marshaled requirements %q", bs)
+	}
+}
+
+func TestValidateRequirementSelector(t *testing.T) {
+	types := sets.NewString("presubmit", "postsubmit", "periodic")
+	arches := sets.NewString("amd64", "arm64")
+	if err := ValidateRequirementSelector(spec.RequirementSelector{
+		Types:    []string{"postsubmit"},
+		Branches: []string{"release-.*"},
+		Arch:     []string{"arm64"},
+	}, types, arches); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, selector := range []spec.RequirementSelector{
+		{Types: []string{"batch"}},
+		{Arch: []string{"s390x"}},
+		{Branches: []string{"release-("}},
+	} {
+		if err := ValidateRequirementSelector(selector, types, arches); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("%+v: expected %v, got %v", selector, ErrInvalidSelector, err)
+		}
+	}
+}
@@ -14,18 +14,78 @@
 
 package decorator
 
-import v1 "k8s.io/api/core/v1"
+import (
+	"github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
 
 const (
 	defaultResource = "default"
 )
 
-func ApplyResource(c *v1.Container, jobResourceName string, presetMap map[string]v1.ResourceRequirements) {
+// ApplyResource sets the resources of the container to the preset of the job,
+// or the default one if the job has none, resolved for the architecture and
+// type of the job with the overrides of the preset.
+func ApplyResource(c *v1.Container, jobResourceName, arch, jobType string,
+	presetMap map[string]v1.ResourceRequirements, overridesMap map[string]spec.ResourcePresetOverrides,
+) {
 	resourceName := defaultResource
 	if jobResourceName != "" {
 		resourceName = jobResourceName
 	}
-	if _, ok := presetMap[resourceName]; ok {
-		c.Resources = presetMap[resourceName]
+	if preset, ok := presetMap[resourceName]; ok {
+		c.Resources = ResolveResource(preset, overridesMap[resourceName], arch, jobType)
+	}
+}
+
+// ResolveResource returns the resources of the preset with the overrides of
+// the architecture and then of the job type merged onto them.
+func ResolveResource(preset v1.ResourceRequirements, overrides spec.ResourcePresetOverrides, arch, jobType string) v1.ResourceRequirements {
+	resources := *preset.DeepCopy()
+	for _, override := range []struct {
+		overrides map[string]v1.ResourceRequirements
+		key       string
+	}{{overrides.Arch, arch}, {overrides.Types, jobType}} {
+		o, ok := override.overrides[override.key]
+		if !ok {
+			continue
+		}
+		resources.Requests = mergeResourceList(resources.Requests, o.Requests)
+		resources.Limits = mergeResourceList(resources.Limits, o.Limits)
+	}
+	return resources
+}
+
+func mergeResourceList(list, override v1.ResourceList) v1.ResourceList {
+	if len(override) == 0 {
+		return list
+	}
+	if list == nil {
+		list = v1.ResourceList{}
+	}
+	for name, quantity := range override {
+		list[name] = quantity.DeepCopy()
+	}
+	return list
+}
+
+// ValidateResourcePresetOverrides returns an error for each of the arch and
+// types overrides of a preset that is not one of the architectures or job
+// types.
+func ValidateResourcePresetOverrides(overrides spec.ResourcePresetOverrides, types, arches sets.String) error {
+	var err error
+	for _, a := range sets.StringKeySet(overrides.Arch).List() {
+		if e := validate(a, arches, "arch", ErrInvalidResourceOverride); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+	for _, t := range sets.StringKeySet(overrides.Types).List() {
+		if e := validate(t, types, "types", ErrInvalidResourceOverride); e != nil {
+			err = multierror.Append(err, e)
+		}
 	}
+	return err
 }
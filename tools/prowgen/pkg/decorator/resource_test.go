@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestResolveResource(t *testing.T) {
+	var preset v1.ResourceRequirements
+	if err := yaml.Unmarshal([]byte(`
+requests: {cpu: 1, memory: 4Gi}
+limits: {cpu: 2, memory: 8Gi}
+`), &preset); err != nil {
+		t.Fatal(err)
+	}
+	var overrides spec.ResourcePresetOverrides
+	if err := yaml.Unmarshal([]byte(`
+arch:
+  arm64:
+    requests: {cpu: 2}
+    limits: {cpu: 4}
+types:
+  periodic:
+    limits: {cpu: 8, memory: 16Gi}
+`), &overrides); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arch     string
+		jobType  string
+		requests map[string]string
+		limits   map[string]string
+	}{
+		{
+			arch:     "amd64",
+			jobType:  "presubmit",
+			requests: map[string]string{"cpu": "1", "memory": "4Gi"},
+			limits:   map[string]string{"cpu": "2", "memory": "8Gi"},
+		},
+		{
+			arch:     "arm64",
+			jobType:  "presubmit",
+			requests: map[string]string{"cpu": "2", "memory": "4Gi"},
+			limits:   map[string]string{"cpu": "4", "memory": "8Gi"},
+		},
+		{
+			arch:     "arm64",
+			jobType:  "periodic",
+			requests: map[string]string{"cpu": "2", "memory": "4Gi"},
+			limits:   map[string]string{"cpu": "8", "memory": "16Gi"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arch+"_"+tt.jobType, func(t *testing.T) {
+			resources := ResolveResource(preset, overrides, tt.arch, tt.jobType)
+			requests := map[string]string{}
+			for name, q := range resources.Requests {
+				requests[string(name)] = q.String()
+			}
+			limits := map[string]string{}
+			for name, q := range resources.Limits {
+				limits[string(name)] = q.String()
+			}
+			if diff := cmp.Diff(tt.requests, requests); diff != "" {
+				t.Errorf("requests: (-want, +got): %s", diff)
+			}
+			if diff := cmp.Diff(tt.limits, limits); diff != "" {
+				t.Errorf("limits: (-want, +got): %s", diff)
+			}
+		})
+	}
+}
@@ -15,11 +15,12 @@
 package decorator
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
-	"regexp"
 	"strings"
 
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
 
 	"istio.io/test-infra/tools/prowgen/pkg/spec"
@@ -30,8 +31,6 @@ const (
 	paramsPrefix = "params."
 )
 
-var variableSubstitutionRegex = regexp.MustCompile(`\$\([_a-zA-Z0-9.-]+(\.[_a-zA-Z0-9.-]+)*\)`)
-
 func applyArch(arch string, job spec.Job, clusterOverrides map[string]string) spec.Job {
 	// For backwards compatibility, amd64 is not suffixed
 	if arch != "amd64" {
@@ -48,122 +47,275 @@ func applyArch(arch string, job spec.Job, clusterOverrides map[string]string) sp
 	return job
 }
 
+// Builtins are the values of the built-in variables for the generated jobs.
+type Builtins struct {
+	Org    string
+	Repo   string
+	Branch string
+}
+
+// ApplyVariables resolves the $(params.key), $(matrix.dimension) and built-in
+// variable expressions in the string fields of the job, for each architecture
+// and combination of the matrix dimensions referenced by the job.
 func ApplyVariables(
 	job spec.Job,
 	architectures []string,
 	params map[string]string,
 	matrix map[string][]string,
 	overrides map[string]string,
-) []spec.Job {
-	yamlBS, err := yaml.Marshal(job)
+	builtins Builtins,
+) ([]spec.Job, error) {
+	tree, err := toTree(job)
 	if err != nil {
-		log.Fatalf("Failed to marshal the given Job: %v", err)
+		return nil, fmt.Errorf("failed to marshal the given Job: %w", err)
+	}
+	exps, err := collectExpressions(tree)
+	if err != nil {
+		return nil, err
 	}
 
 	jobs := make([]spec.Job, 0)
 
 	for _, arch := range architectures {
-		subsExps := getVarSubstitutionExpressions(string(yamlBS))
-		if len(subsExps) == 0 && len(architectures) == 1 {
+		if len(exps) == 0 && len(architectures) == 1 {
 			jobs = append(jobs, applyArch(arch, job, overrides))
 			continue
 		}
-		if params == nil {
-			params = map[string]string{}
+		vars := map[string]string{
+			VariableBranch: builtins.Branch,
+			VariableOrg:    builtins.Org,
+			VariableRepo:   builtins.Repo,
 		}
-		params["arch"] = arch
-
-		resolvedYAMLStr := applyParams(string(yamlBS), subsExps, params)
-		resolvedYAMLStrs := applyMatrix(resolvedYAMLStr, subsExps, matrix)
+		for k, v := range params {
+			vars[paramsPrefix+k] = v
+		}
+		vars[paramsPrefix+"arch"] = arch
 
-		for _, jobYaml := range resolvedYAMLStrs {
+		combs, err := matrixCombinations(exps, matrix, job.MatrixExclude, job.MatrixInclude)
+		if err != nil {
+			return nil, err
+		}
+		for _, comb := range combs {
+			lookup := func(variable string) (string, bool) {
+				if dim, ok := strings.CutPrefix(variable, matrixPrefix); ok {
+					val, ok := comb[dim]
+					return val, ok
+				}
+				val, ok := vars[variable]
+				return val, ok
+			}
+			resolved, err := substituteStrings(tree, func(str string) (string, error) {
+				return substitute(str, lookup)
+			})
+			if err != nil {
+				return nil, err
+			}
 			job := spec.Job{}
-			if err := yaml.Unmarshal([]byte(jobYaml), &job); err != nil {
-				log.Fatalf("Failed to unmarshal the yaml to Job: %v", err)
+			if err := fromTree(resolved, &job); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal the resolved Job: %w", err)
 			}
 			jobs = append(jobs, applyArch(arch, job, overrides))
 		}
 	}
-	return jobs
+	return jobs, nil
 }
 
-// applyParams will resolve all the $(params.key) expressions into the
-// configured values.
-func applyParams(yamlStr string, subsExps []string, params map[string]string) string {
-	for _, exp := range subsExps {
-		if strings.HasPrefix(exp, paramsPrefix) {
-			exp = strings.TrimPrefix(exp, paramsPrefix)
-			if val, ok := params[exp]; ok {
-				yamlStr = replace(yamlStr, paramsPrefix, exp, val)
-			} else {
-				log.Fatalf("Param %q not configured in the params map %v", exp, params)
+// UnresolvedVariables returns the $(params.key) and $(matrix.dimension)
+// expressions referenced by the job that are not configured in the params
+// map or the matrix and have no default. The arch param and the built-in
+// variables are always available.
+func UnresolvedVariables(job spec.Job, params map[string]string, matrix map[string][]string) []string {
+	tree, err := toTree(job)
+	if err != nil {
+		return nil
+	}
+	// Invalid expressions are reported when applying the variables.
+	exps, _ := collectExpressions(tree)
+	var unresolved []string
+	for _, exp := range exps {
+		if exp.def != nil {
+			continue
+		}
+		switch {
+		case exp.variable == paramsPrefix+"arch":
+		case strings.HasPrefix(exp.variable, paramsPrefix):
+			if _, ok := params[strings.TrimPrefix(exp.variable, paramsPrefix)]; !ok {
+				unresolved = append(unresolved, exp.text)
+			}
+		case strings.HasPrefix(exp.variable, matrixPrefix):
+			if _, ok := matrix[strings.TrimPrefix(exp.variable, matrixPrefix)]; !ok {
+				unresolved = append(unresolved, exp.text)
 			}
 		}
 	}
-	return yamlStr
+	return unresolved
+}
+
+// toTree converts the object into its generic JSON form.
+func toTree(obj interface{}) (interface{}, error) {
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(bs, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
 }
 
-// applyMatrix will resolve all the $(matrix.dimension) expressions into the
-// configured lists of values, and then calculate all the combinations.
-func applyMatrix(yamlStr string, subsExps []string, matrix map[string][]string) []string {
-	combs := make([]string, 0)
-	for _, exp := range subsExps {
-		if strings.HasPrefix(exp, matrixPrefix) {
-			exp = strings.TrimPrefix(exp, matrixPrefix)
-			if _, ok := matrix[exp]; ok {
-				combs = append(combs, exp)
-			} else {
-				log.Fatalf("Dimension %q not configured in the matrix %v", exp, matrix)
+func fromTree(tree interface{}, obj interface{}) error {
+	bs, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(bs, obj)
+}
+
+// matrixCombinations returns all the combinations of the matrix dimensions
+// referenced by the expressions. The combinations matching an exclude entry
+// are removed, and the include entries that set all the dimensions are added
+// as extra combinations. Dimensions that are not configured are left to their
+// default value.
+func matrixCombinations(exps []expression, matrix map[string][]string, exclude, include []map[string]string) ([]map[string]string, error) {
+	dims := make([]string, 0)
+	seenDims := sets.NewString()
+	for _, exp := range exps {
+		dim, ok := strings.CutPrefix(exp.variable, matrixPrefix)
+		if !ok || seenDims.Has(dim) {
+			continue
+		}
+		if _, ok := matrix[dim]; !ok {
+			if exp.def != nil {
+				continue
 			}
+			return nil, fmt.Errorf("%w %q, not configured in the matrix %v", ErrUnknownMatrixDimension, dim, matrix)
 		}
+		seenDims.Insert(dim)
+		dims = append(dims, dim)
 	}
 
-	res := &[]string{}
-	resolveCombinations(combs, yamlStr, 0, matrix, res)
-	return *res
+	all := &[]map[string]string{}
+	resolveCombinations(dims, map[string]string{}, 0, matrix, all)
+
+	combs := make([]map[string]string, 0, len(*all))
+	for _, comb := range *all {
+		if !matchesAny(comb, dims, exclude) {
+			combs = append(combs, comb)
+		}
+	}
+	// Include entries matching an existing combination are no-ops.
+	for _, entry := range include {
+		if !coversAll(entry, dims) {
+			continue
+		}
+		comb := map[string]string{}
+		for _, dim := range dims {
+			comb[dim] = entry[dim]
+		}
+		if !matchesAny(comb, dims, combs) {
+			combs = append(combs, comb)
+		}
+	}
+	return combs, nil
 }
 
-func resolveCombinations(combs []string, dest string, start int, matrix map[string][]string, res *[]string) {
-	if start == len(combs) {
-		*res = append(*res, dest)
+func resolveCombinations(dims []string, comb map[string]string, start int, matrix map[string][]string, res *[]map[string]string) {
+	if start == len(dims) {
+		*res = append(*res, copyCombination(comb))
 		return
 	}
 
-	lst := matrix[combs[start]]
-	for i := range lst {
-		dest := replace(dest, matrixPrefix, combs[start], lst[i])
-		resolveCombinations(combs, dest, start+1, matrix, res)
+	for _, val := range matrix[dims[start]] {
+		comb[dims[start]] = val
+		resolveCombinations(dims, comb, start+1, matrix, res)
 	}
+	delete(comb, dims[start])
 }
 
-// replace replaces the expressions written as $(prefix.expKey) with the expVal
-func replace(str, expType, expKey, expVal string) string {
-	return strings.ReplaceAll(str, fmt.Sprintf("$(%s%s)", expType, expKey), expVal)
+// matchesAny returns true if the combination matches all the values of one of
+// the entries. Entries setting a dimension the job does not use never match.
+func matchesAny(comb map[string]string, dims []string, entries []map[string]string) bool {
+	used := sets.NewString(dims...)
+	for _, entry := range entries {
+		if len(entry) == 0 || !used.HasAll(sets.StringKeySet(entry).UnsortedList()...) {
+			continue
+		}
+		match := true
+		for dim, val := range entry {
+			if comb[dim] != val {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
 }
 
-// getVarSubstitutionExpressions extracts all the value between "$(" and ")""
-func getVarSubstitutionExpressions(yamlStr string) []string {
-	allExpressions := validateString(yamlStr)
-	return allExpressions
+// coversAll returns true if the entry sets all the given dimensions.
+func coversAll(entry map[string]string, dims []string) bool {
+	if len(dims) == 0 {
+		return false
+	}
+	for _, dim := range dims {
+		if _, ok := entry[dim]; !ok {
+			return false
+		}
+	}
+	return true
 }
 
-func validateString(value string) []string {
-	expressions := variableSubstitutionRegex.FindAllString(value, -1)
-	if expressions == nil {
-		return nil
+func copyCombination(comb map[string]string) map[string]string {
+	res := make(map[string]string, len(comb))
+	for k, v := range comb {
+		res[k] = v
 	}
-	var result []string
-	set := map[string]bool{}
-	for _, expression := range expressions {
-		expression = stripVarSubExpression(expression)
-		if _, ok := set[expression]; !ok {
-			result = append(result, expression)
-			set[expression] = true
+	return res
+}
+
+// ValidateMatrixInclude returns an error for each of the include entries that
+// sets a dimension that is not configured in the matrix. The combinations of
+// the matrix have no value for such a dimension to be combined with the entry.
+// The values can be new, as they are the point of including an entry.
+func ValidateMatrixInclude(include []map[string]string, matrix map[string][]string) error {
+	var err error
+	for _, entry := range include {
+		if len(entry) == 0 {
+			err = multierror.Append(err, fmt.Errorf("%w: empty entry in matrix_include", ErrUnknownMatrixCombination))
+			continue
+		}
+		for _, dim := range sets.StringKeySet(entry).List() {
+			if _, ok := matrix[dim]; !ok {
+				err = multierror.Append(err, fmt.Errorf("%w %q in matrix_include, not configured in the matrix %v", ErrUnknownMatrixDimension, dim, matrix))
+			}
 		}
 	}
-	return result
+	return err
 }
 
-func stripVarSubExpression(expression string) string {
-	return strings.TrimSuffix(strings.TrimPrefix(expression, "$("), ")")
+// ValidateMatrixExclude returns an error for each of the exclude entries that
+// does not match any combination of the matrix, i.e. that sets a dimension
+// or a value that is not configured in it.
+func ValidateMatrixExclude(exclude []map[string]string, matrix map[string][]string) error {
+	var err error
+	for _, entry := range exclude {
+		if len(entry) == 0 {
+			err = multierror.Append(err, fmt.Errorf("%w: empty entry in matrix_exclude", ErrUnknownMatrixCombination))
+			continue
+		}
+		for _, dim := range sets.StringKeySet(entry).List() {
+			vals, ok := matrix[dim]
+			if !ok {
+				err = multierror.Append(err, fmt.Errorf("%w %q in matrix_exclude, not configured in the matrix %v", ErrUnknownMatrixDimension, dim, matrix))
+				continue
+			}
+			if e := validate(entry[dim], sets.NewString(vals...), "matrix_exclude dimension "+dim, ErrUnknownMatrixCombination); e != nil {
+				err = multierror.Append(err, e)
+			}
+		}
+	}
+	return err
 }
@@ -0,0 +1,107 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateMatrixExclude(t *testing.T) {
+	matrix := map[string][]string{
+		"k8s":  {"1.28", "1.29"},
+		"arch": {"amd64", "arm64"},
+	}
+	tests := []struct {
+		name    string
+		exclude []map[string]string
+		want    error
+	}{
+		{
+			name:    "valid",
+			exclude: []map[string]string{{"k8s": "1.28", "arch": "arm64"}, {"k8s": "1.29"}},
+		},
+		{
+			name:    "unknown dimension",
+			exclude: []map[string]string{{"k8s": "1.28", "os": "linux"}},
+			want:    ErrUnknownMatrixDimension,
+		},
+		{
+			name:    "unknown value",
+			exclude: []map[string]string{{"k8s": "1.27"}},
+			want:    ErrUnknownMatrixCombination,
+		},
+		{
+			name:    "empty entry",
+			exclude: []map[string]string{{}},
+			want:    ErrUnknownMatrixCombination,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMatrixExclude(tt.exclude, matrix)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateMatrixInclude(t *testing.T) {
+	matrix := map[string][]string{
+		"k8s":  {"1.28", "1.29"},
+		"arch": {"amd64", "arm64"},
+	}
+	tests := []struct {
+		name    string
+		include []map[string]string
+		want    error
+	}{
+		{
+			name:    "new value",
+			include: []map[string]string{{"k8s": "1.30", "arch": "amd64"}},
+		},
+		{
+			name:    "unknown dimension",
+			include: []map[string]string{{"k8s": "1.30", "os": "linux"}},
+			want:    ErrUnknownMatrixDimension,
+		},
+		{
+			name:    "empty entry",
+			include: []map[string]string{{}},
+			want:    ErrUnknownMatrixCombination,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMatrixInclude(tt.include, matrix)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
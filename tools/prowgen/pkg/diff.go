@@ -0,0 +1,204 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"sigs.k8s.io/prow/pkg/config"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// JobDiff is the difference of a single job between the committed and the
+// generated config.
+type JobDiff struct {
+	Type    string        `json:"type"`
+	Name    string        `json:"name"`
+	Action  string        `json:"action"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is a changed field of a job. Field is the path of the field in
+// the job, e.g. spec.containers[0].image, and Old and New are its JSON encoded
+// values, which are empty if the field is added or removed.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+func (d JobDiff) String() string {
+	return fmt.Sprintf("%s %s job %s", d.Action, d.Type, d.Name)
+}
+
+func (c FieldChange) String() string {
+	o, n := c.Old, c.New
+	if o == "" {
+		o = "<none>"
+	}
+	if n == "" {
+		n = "<none>"
+	}
+	return fmt.Sprintf("%s: %s → %s", c.Field, o, n)
+}
+
+// Diff compares the generated Prow jobs with the ones in the current config
+// file job by job. A missing file is treated as an empty config.
+func Diff(jobs config.JobConfig, currentConfigFile string) ([]JobDiff, error) {
+	current := config.JobConfig{}
+	bs, err := os.ReadFile(currentConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read current config for %s: %w", currentConfigFile, err)
+	}
+	if err := yaml.Unmarshal(bs, &current); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal current config for %s: %w", currentConfigFile, err)
+	}
+
+	currentJobs, err := flattenJobs(current)
+	if err != nil {
+		return nil, err
+	}
+	newJobs, err := flattenJobs(jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []JobDiff
+	for key, newFields := range newJobs {
+		oldFields, ok := currentJobs[key]
+		if !ok {
+			diffs = append(diffs, JobDiff{Type: key.typ, Name: key.name, Action: DiffAdded})
+			continue
+		}
+		if changes := diffFields(oldFields, newFields); len(changes) > 0 {
+			diffs = append(diffs, JobDiff{Type: key.typ, Name: key.name, Action: DiffChanged, Changes: changes})
+		}
+	}
+	for key := range currentJobs {
+		if _, ok := newJobs[key]; !ok {
+			diffs = append(diffs, JobDiff{Type: key.typ, Name: key.name, Action: DiffRemoved})
+		}
+	}
+
+	typeOrder := map[string]int{TypePresubmit: 0, TypePostsubmit: 1, TypePeriodic: 2}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Type != diffs[j].Type {
+			return typeOrder[diffs[i].Type] < typeOrder[diffs[j].Type]
+		}
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs, nil
+}
+
+type jobKey struct {
+	typ  string
+	name string
+}
+
+// flattenJobs flattens each of the jobs into a map of field path to JSON
+// encoded value, keyed by the job type and name.
+func flattenJobs(jobs config.JobConfig) (map[jobKey]map[string]string, error) {
+	res := map[jobKey]map[string]string{}
+	add := func(typ, name string, job interface{}) error {
+		fields, err := flattenJob(job)
+		if err != nil {
+			return fmt.Errorf("failed to flatten %s %s: %w", typ, name, err)
+		}
+		res[jobKey{typ, name}] = fields
+		return nil
+	}
+	for _, pres := range jobs.PresubmitsStatic {
+		for _, job := range pres {
+			if err := add(TypePresubmit, job.Name, job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, posts := range jobs.PostsubmitsStatic {
+		for _, job := range posts {
+			if err := add(TypePostsubmit, job.Name, job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, job := range jobs.Periodics {
+		if err := add(TypePeriodic, job.Name, job); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func flattenJob(job interface{}) (map[string]string, error) {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	var obj interface{}
+	if err := json.Unmarshal(bs, &obj); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	flatten("", obj, fields)
+	return fields, nil
+}
+
+func flatten(prefix string, obj interface{}, fields map[string]string) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range o {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flatten(k, v, fields)
+		}
+	case []interface{}:
+		for i, v := range o {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), v, fields)
+		}
+	default:
+		bs, _ := json.Marshal(o)
+		fields[prefix] = string(bs)
+	}
+}
+
+// diffFields returns the changed fields between two flattened jobs, sorted by
+// field path.
+func diffFields(oldFields, newFields map[string]string) []FieldChange {
+	var changes []FieldChange
+	for f, nv := range newFields {
+		if ov := oldFields[f]; ov != nv {
+			changes = append(changes, FieldChange{Field: f, Old: ov, New: nv})
+		}
+	}
+	for f, ov := range oldFields {
+		if _, ok := newFields[f]; !ok {
+			changes = append(changes, FieldChange{Field: f, Old: ov})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/prow/pkg/config"
+)
+
+func TestDiff(t *testing.T) {
+	bc, err := ReadBase(nil, "testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{BaseConfig: bc}
+	jobs, err := cli.ReadJobsConfig("testdata/simple.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := cli.ConvertJobConfig("simple.yaml", jobs, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := Diff(output, "testdata/simple.gen.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("Expected no diff against the golden file, got %v", diffs)
+	}
+
+	// Change the image of the first periodic, drop the second one and add a new one.
+	output.Periodics[0].Spec.Containers[0].Image = "newimage"
+	removed := output.Periodics[1].Name
+	output.Periodics = append(output.Periodics[:1], config.Periodic{
+		JobBase: config.JobBase{Name: "new-job_istio_periodic"},
+		Cron:    "0 2 * * *",
+	})
+	diffs, err = Diff(output, "testdata/simple.gen.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []JobDiff{
+		{
+			Type:   TypePeriodic,
+			Name:   "new-job_istio_periodic",
+			Action: DiffAdded,
+		},
+		{
+			Type:   TypePeriodic,
+			Name:   output.Periodics[0].Name,
+			Action: DiffChanged,
+			Changes: []FieldChange{
+				{Field: "spec.containers[0].image", Old: `"fooimage"`, New: `"newimage"`},
+			},
+		},
+		{
+			Type:   TypePeriodic,
+			Name:   removed,
+			Action: DiffRemoved,
+		},
+	}
+	if diff := cmp.Diff(expected, diffs); diff != "" {
+		t.Fatalf("Job diffs do not match, (-want, +got): \n%s", diff)
+	}
+}
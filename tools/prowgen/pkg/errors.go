@@ -0,0 +1,82 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when generating the jobs, which can be matched with errors.Is.
+var (
+	ErrInvalidCron          = errors.New("invalid cron")
+	ErrInvalidInterval      = errors.New("invalid interval")
+	ErrInvalidSchedule      = errors.New("invalid schedule")
+	ErrInvalidChangeMatcher = errors.New("invalid change matcher")
+	ErrJobNameTooLong       = errors.New("job name too long")
+	ErrUnknownParentJob     = errors.New("unknown parent job")
+	ErrExtendsCycle         = errors.New("cycle in extends")
+	ErrImportCycle          = errors.New("cycle in imports")
+	ErrJobNotFound          = errors.New("job not found")
+	// ErrNestedAutogenHeader is only returned for the .base.yaml files
+	// setting another autogen_header than the one they are overlaid on, so
+	// that the root .base.yaml files of several trees, e.g. read in turn by
+	// prowtrans, can set the same one.
+	ErrNestedAutogenHeader = errors.New("autogen_header cannot be changed by a nested .base.yaml")
+)
+
+// FieldError is an error attributed to a field of a meta config file. Path
+// is the list of map keys and sequence indexes leading to the field, e.g.
+// ["jobs", "2", "requirements", "0"].
+type FieldError struct {
+	File string
+	Path []string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// FieldPath returns the path in a human readable form, e.g. jobs[2].requirements[0].
+func (e *FieldError) FieldPath() string {
+	var sb strings.Builder
+	for _, p := range e.Path {
+		if _, err := strconv.Atoi(p); err == nil {
+			sb.WriteString("[" + p + "]")
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(p)
+	}
+	return sb.String()
+}
+
+// fieldPath builds a FieldError path from map keys and sequence indexes.
+func fieldPath(elems ...interface{}) []string {
+	path := make([]string, 0, len(elems))
+	for _, e := range elems {
+		path = append(path, fmt.Sprint(e))
+	}
+	return path
+}
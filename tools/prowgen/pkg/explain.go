@@ -0,0 +1,542 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/prow/pkg/config"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// Layers of the fields of the generated Prow jobs that are not a file or a
+// preset.
+const (
+	// LayerProwgen is the layer of the fields prowgen sets on all the jobs,
+	// or derives from the other fields, e.g. the triggers.
+	LayerProwgen = "prowgen"
+	// LayerBase is the layer of the fields of the .base.yaml files, see
+	// ExplainBase for the file of each field.
+	LayerBase = ".base.yaml"
+	// LayerAutoMaxProcs is the layer of the GOMAXPROCS env var set with the
+	// auto_max_procs field of the .base.yaml files.
+	LayerAutoMaxProcs = "auto_max_procs"
+)
+
+// expansionMarker delimits the values of the params and matrix dimensions in
+// the jobs generated to find the fields they are substituted in.
+const expansionMarker = "\x00"
+
+// FieldProvenance is a field of a generated Prow job, e.g.
+// spec.containers[0].env[GOFLAGS].value, with the layer that set it last: one
+// of LayerProwgen, LayerBase, the meta config file, a job extended by the job,
+// e.g. extends pilot.yaml:integ-pilot, the job in the file, e.g.
+// istio.yaml jobs[2], a requirement or modifier preset, e.g.
+// requirement_presets.kind, or LayerAutoMaxProcs. Expanded is true if params or
+// matrix dimensions are substituted in the value.
+type FieldProvenance struct {
+	Field    string      `json:"field"`
+	Value    interface{} `json:"value"`
+	Layer    string      `json:"layer"`
+	Expanded bool        `json:"expanded,omitempty"`
+}
+
+// Explanation is a generated Prow job with the provenance of its fields.
+type Explanation struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	File   string            `json:"file"`
+	Branch string            `json:"branch"`
+	Job    string            `json:"job"`
+	Fields []FieldProvenance `json:"fields"`
+}
+
+// Explain re-runs the generation of the meta config file for the Prow job with
+// the given name, and returns the layer each of its fields comes from. The job
+// is generated from the layers in turn: the .base.yaml files, the file, the
+// jobs it extends, the job, its modifiers, its requirements and
+// auto_max_procs, and each field is attributed to the last layer changing it,
+// except the resources, attributed to the layer defining their preset. It
+// returns ErrJobNotFound if the file does not generate the job.
+func (cli *Client) Explain(file, name string) (*Explanation, error) {
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", file, err)
+	}
+	raw, err := parseRawJobsConfig(cli.InputDir, file, yamlFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %q: %w", file, err)
+	}
+	// The jobs as written in the file, before merging them onto the jobs
+	// they extend.
+	written := spec.JobsConfig{}
+	if err := yaml.UnmarshalStrict(yamlFile, &written); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %q: %w", file, err)
+	}
+	jobsConfig, err := resolveOverwrites(cli.BaseConfig.CommonConfig, cli.BaseConfig.TestgridConfig, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, branch := range jobsConfig.Branches {
+		output, err := cli.ConvertJobConfig(file, jobsConfig, branch)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, ok := findJob(output, name); !ok {
+			continue
+		}
+		for i := range jobsConfig.Jobs {
+			single := jobsConfig
+			single.Jobs = jobsConfig.Jobs[i : i+1]
+			output, err := cli.convertJobConfig(file, single, branch)
+			if err != nil {
+				return nil, err
+			}
+			if job, jobType, ok := findJob(output, name); ok {
+				extended, err := extendedJobs(cli.InputDir, file, written.Jobs, i)
+				if err != nil {
+					return nil, err
+				}
+				return cli.explainJob(file, raw, i, extended, written.Jobs[i], branch, name, jobType, job)
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in %s", ErrJobNotFound, name, file)
+}
+
+// explainJob returns the provenance of the fields of the job generated from the
+// job i of the meta config file, written as own in the file and extending the
+// extended jobs.
+func (cli *Client) explainJob(file string, raw spec.JobsConfig, i int, extended []extendedJob, own spec.Job,
+	branch, name, jobType string, job interface{},
+) (*Explanation, error) {
+	fields, err := jobFields(job)
+	if err != nil {
+		return nil, err
+	}
+	raw.Jobs = raw.Jobs[i : i+1]
+	parent := raw.Jobs[0]
+
+	// Generates the job from the base config and the meta config, not
+	// validated as the partial configs may miss required fields.
+	generate := func(cli *Client, raw spec.JobsConfig) (map[string]interface{}, error) {
+		jobsConfig, err := resolveOverwrites(cli.BaseConfig.CommonConfig, cli.BaseConfig.TestgridConfig, raw)
+		if err != nil {
+			return nil, err
+		}
+		output, err := cli.convertJobConfig(file, jobsConfig, branch)
+		if err != nil {
+			return nil, err
+		}
+		job, _, ok := findJob(output, name)
+		if !ok {
+			return map[string]interface{}{}, nil
+		}
+		return jobFields(job)
+	}
+
+	merged, err := mergeCommonConfig(cli.BaseConfig.CommonConfig, raw.CommonConfig, parent.CommonConfig)
+	if err != nil {
+		return nil, err
+	}
+	modifiers := uniqueStrings(merged.Modifiers)
+	requirements := uniqueStrings(spec.RequirementNames(merged.Requirements))
+	// withPresets returns the meta config with only the first m modifiers and
+	// r requirements of the job applied, in order.
+	withPresets := func(m, r int) spec.JobsConfig {
+		jobsConfig := raw
+		jobsConfig.Modifiers = nil
+		job := parent
+		job.Modifiers = modifiers[:m]
+		job.ExcludedRequirements = append(append([]string(nil), parent.ExcludedRequirements...), requirements[r:]...)
+		jobsConfig.Jobs = []spec.Job{job}
+		return jobsConfig
+	}
+	noPresets := *cli
+	noPresets.BaseConfig.Modifiers = nil
+	noPresets.BaseConfig.AutoMaxProcs = false
+
+	// The definitions and the name of the job are kept in all the layers, for
+	// the job to be generated with the same name.
+	defsBase := noPresets
+	defsBase.BaseConfig = spec.BaseConfig{
+		CommonConfig:    commonDefinitions(cli.BaseConfig.CommonConfig),
+		JobNameTemplate: cli.BaseConfig.JobNameTemplate,
+	}
+	defsFile := raw
+	defsFile.CommonConfig = commonDefinitions(raw.CommonConfig)
+	defsFile.TestgridConfig = nil
+	defsFile.Images = nil
+	defsFile.Jobs = []spec.Job{{
+		CommonConfig:  commonDefinitions(parent.CommonConfig),
+		Name:          parent.Name,
+		Types:         parent.Types,
+		Architectures: parent.Architectures,
+	}}
+	defsFile.Jobs[0].ExcludedRequirements = requirements
+	withFile := defsFile
+	withFile.CommonConfig = raw.CommonConfig
+	withFile.Modifiers = nil
+	withFile.TestgridConfig = raw.TestgridConfig
+	withFile.Images = raw.Images
+
+	type layer struct {
+		name       string
+		cli        *Client
+		jobsConfig spec.JobsConfig
+	}
+	jobLayer := fmt.Sprintf("%s jobs[%d]", file, i)
+	layers := []layer{
+		{LayerProwgen, &defsBase, defsFile},
+		{LayerBase, &noPresets, defsFile},
+		{file, &noPresets, withFile},
+	}
+	// The jobs extended by the job are applied in turn, each merged onto
+	// its own parents, with the name, types and architectures of the job
+	// for it to be generated with the same name.
+	for _, e := range extended {
+		jobsConfig := withPresets(0, 0)
+		ancestor := e.resolved
+		ancestor.Name, ancestor.Types, ancestor.Architectures = parent.Name, parent.Types, parent.Architectures
+		ancestor.Modifiers = nil
+		ancestor.ExcludedRequirements = append(append([]string(nil), ancestor.ExcludedRequirements...), requirements...)
+		jobsConfig.Jobs = []spec.Job{ancestor}
+		layers = append(layers, layer{extendsLayer(e.file, e.job.Name), &noPresets, jobsConfig})
+	}
+	layers = append(layers, layer{jobLayer, &noPresets, withPresets(0, 0)})
+	// The presets are applied in order on top of the meta config, the
+	// modifiers first.
+	for m, modifier := range modifiers {
+		layers = append(layers, layer{"modifier_presets." + modifier, &noPresets, withPresets(m+1, 0)})
+	}
+	for r, requirement := range requirements {
+		layers = append(layers, layer{"requirement_presets." + requirement, &noPresets, withPresets(len(modifiers), r+1)})
+	}
+	if cli.BaseConfig.AutoMaxProcs {
+		withAutoMaxProcs := noPresets
+		withAutoMaxProcs.BaseConfig.AutoMaxProcs = true
+		layers = append(layers, layer{LayerAutoMaxProcs, &withAutoMaxProcs, withPresets(len(modifiers), len(requirements))})
+	}
+
+	// The layer that set a field last is the last one changing it.
+	provenance := map[string]string{}
+	previous := map[string]interface{}{}
+	for _, l := range layers {
+		current, err := generate(l.cli, l.jobsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the job up to %s: %w", l.name, err)
+		}
+		for field, value := range current {
+			if p, ok := previous[field]; !ok || p != value {
+				provenance[field] = l.name
+			}
+		}
+		previous = current
+	}
+
+	// The resources are set from a preset as a whole, so they come from the
+	// last layer defining the preset or its overrides, even if another
+	// preset, e.g. the default one of a previous layer, sets some of them to
+	// the same value.
+	resources := merged.Resources
+	if resources == "" {
+		resources = "default"
+	}
+	type presetsLayer struct {
+		name   string
+		config spec.CommonConfig
+	}
+	presetsLayers := []presetsLayer{
+		{LayerBase, cli.BaseConfig.CommonConfig},
+		{file, raw.CommonConfig},
+	}
+	for _, e := range extended {
+		presetsLayers = append(presetsLayers, presetsLayer{extendsLayer(e.file, e.job.Name), e.job.CommonConfig})
+	}
+	presetsLayers = append(presetsLayers, presetsLayer{jobLayer, own.CommonConfig})
+	presetLayer := ""
+	for _, l := range presetsLayers {
+		_, preset := l.config.ResourcePresets[resources]
+		_, overrides := l.config.ResourcePresetOverrides[resources]
+		if preset || overrides {
+			presetLayer = l.name
+		}
+	}
+	if presetLayer != "" {
+		for field := range fields {
+			if strings.HasPrefix(field, "spec.containers[") && strings.Contains(field, "].resources.") {
+				provenance[field] = presetLayer
+			}
+		}
+	}
+
+	expanded, err := cli.expandedFields(file, raw, branch, name)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{Name: name, Type: jobType, File: file, Branch: branch, Job: parent.Name}
+	for _, field := range sortedKeys(fields) {
+		layer, ok := provenance[field]
+		if !ok {
+			layer = LayerProwgen
+		}
+		explanation.Fields = append(explanation.Fields, FieldProvenance{
+			Field:    field,
+			Value:    fields[field],
+			Layer:    layer,
+			Expanded: expanded[field],
+		})
+	}
+	return explanation, nil
+}
+
+// extendsLayer returns the layer of the fields of the job of the file extended
+// by the explained job, e.g. extends pilot/istio.yaml:integ-pilot.
+func extendsLayer(file, job string) string {
+	return "extends " + file + ":" + job
+}
+
+// expandedFields returns the fields of the job the params or matrix dimensions
+// are substituted in, by generating it with marked values.
+func (cli *Client) expandedFields(file string, raw spec.JobsConfig, branch, name string) (map[string]bool, error) {
+	mark := func(v string) string {
+		return expansionMarker + v + expansionMarker
+	}
+	markMaps := func(ms []map[string]string) []map[string]string {
+		marked := make([]map[string]string, 0, len(ms))
+		for _, m := range ms {
+			mm := map[string]string{}
+			for k, v := range m {
+				mm[k] = mark(v)
+			}
+			marked = append(marked, mm)
+		}
+		return marked
+	}
+	jobsConfig, err := resolveOverwrites(cli.BaseConfig.CommonConfig, cli.BaseConfig.TestgridConfig, raw)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]string{}
+	for k, v := range jobsConfig.Params {
+		params[k] = mark(v)
+	}
+	jobsConfig.Params = params
+	matrix := map[string][]string{}
+	for dim, values := range jobsConfig.Matrix {
+		for _, v := range values {
+			matrix[dim] = append(matrix[dim], mark(v))
+		}
+	}
+	jobsConfig.Matrix = matrix
+	job := jobsConfig.Jobs[0]
+	job.MatrixExclude = markMaps(job.MatrixExclude)
+	job.MatrixInclude = markMaps(job.MatrixInclude)
+	jobsConfig.Jobs = []spec.Job{job}
+
+	// The markers make the names longer.
+	c := *cli
+	c.LongJobNamesAllowed = true
+	output, err := c.convertJobConfig(file, jobsConfig, branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the job with marked params and matrix: %w", err)
+	}
+	expanded := map[string]bool{}
+	for _, jobs := range [][]interface{}{presubmitJobs(output), postsubmitJobs(output), periodicJobs(output)} {
+		for _, j := range jobs {
+			if strings.ReplaceAll(jobName(j), expansionMarker, "") != name {
+				continue
+			}
+			fields, err := jobFields(j)
+			if err != nil {
+				return nil, err
+			}
+			for field, value := range fields {
+				if s, ok := value.(string); ok && strings.Contains(s, expansionMarker) {
+					expanded[strings.ReplaceAll(field, expansionMarker, "")] = true
+				}
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// commonDefinitions returns the fields of the common config that do not set
+// fields of the jobs by themselves, but define the presets, params and matrix
+// the jobs refer to, and how their names are generated.
+func commonDefinitions(commonConfig spec.CommonConfig) spec.CommonConfig {
+	return spec.CommonConfig{
+		JobNamePolicy:      commonConfig.JobNamePolicy,
+		Matrix:             commonConfig.Matrix,
+		MatrixExclude:      commonConfig.MatrixExclude,
+		MatrixInclude:      commonConfig.MatrixInclude,
+		Params:             commonConfig.Params,
+		RequirementPresets: commonConfig.RequirementPresets,
+		ModifierPresets:    commonConfig.ModifierPresets,
+	}
+}
+
+// findJob returns the job named name in the job config, with its type.
+func findJob(jc config.JobConfig, name string) (interface{}, string, bool) {
+	for jobType, jobs := range map[string][]interface{}{
+		TypePresubmit:  presubmitJobs(jc),
+		TypePostsubmit: postsubmitJobs(jc),
+		TypePeriodic:   periodicJobs(jc),
+	} {
+		for _, job := range jobs {
+			if jobName(job) == name {
+				return job, jobType, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func presubmitJobs(jc config.JobConfig) []interface{} {
+	var jobs []interface{}
+	for _, js := range jc.PresubmitsStatic {
+		for _, j := range js {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+func postsubmitJobs(jc config.JobConfig) []interface{} {
+	var jobs []interface{}
+	for _, js := range jc.PostsubmitsStatic {
+		for _, j := range js {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+func periodicJobs(jc config.JobConfig) []interface{} {
+	jobs := make([]interface{}, 0, len(jc.Periodics))
+	for _, j := range jc.Periodics {
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+func jobName(job interface{}) string {
+	switch j := job.(type) {
+	case config.Presubmit:
+		return j.Name
+	case config.Postsubmit:
+		return j.Name
+	case config.Periodic:
+		return j.Name
+	}
+	return ""
+}
+
+// jobFields returns the fields of the Prow job as in the generated config,
+// keyed by their path. The items of the lists of named objects, e.g. env or
+// volumes, are keyed by name, and the volume mounts by mount path.
+func jobFields(job interface{}) (map[string]interface{}, error) {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the job: %w", err)
+	}
+	var tree interface{}
+	if err := json.Unmarshal(bs, &tree); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the job: %w", err)
+	}
+	fields := map[string]interface{}{}
+	flattenFields(fields, "", tree)
+	return fields, nil
+}
+
+func flattenFields(fields map[string]interface{}, path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if path != "" {
+				k = path + "." + k
+			}
+			flattenFields(fields, k, child)
+		}
+	case []interface{}:
+		keys := listKeys(path, v)
+		for i, child := range v {
+			flattenFields(fields, fmt.Sprintf("%s[%s]", path, keys[i]), child)
+		}
+	default:
+		fields[path] = value
+	}
+}
+
+// listKeys returns the keys of the items of the list at path: their name, or
+// mount path for the volume mounts, if they all have a different one, their
+// indexes otherwise.
+func listKeys(path string, list []interface{}) []string {
+	key := "name"
+	if strings.HasSuffix(path, "volumeMounts") {
+		key = "mountPath"
+	}
+	keys := make([]string, 0, len(list))
+	seen := map[string]bool{}
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			break
+		}
+		k, ok := m[key].(string)
+		if !ok || k == "" || seen[k] {
+			break
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	if len(keys) == len(list) {
+		return keys
+	}
+	keys = make([]string, 0, len(list))
+	for i := range list {
+		keys = append(keys, fmt.Sprint(i))
+	}
+	return keys
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func uniqueStrings(strs []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+	for _, s := range strs {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExplain(t *testing.T) {
+	bc, err := ReadBase(nil, "testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.AutoMaxProcs = true
+	cli := &Client{BaseConfig: bc}
+	file := "testdata/explain.yaml"
+
+	e, err := cli.Explain(file, "integ-security_istio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != TypePresubmit || e.Branch != "master" || e.Job != "integ-$(matrix.suite)" {
+		t.Errorf("Expected the presubmit of integ-$(matrix.suite) for master, got the %s of %s for %s", e.Type, e.Job, e.Branch)
+	}
+	got := map[string]FieldProvenance{}
+	for _, f := range e.Fields {
+		got[f.Field] = f
+	}
+	job := file + " jobs[0]"
+	for _, expected := range []FieldProvenance{
+		{Field: "decorate", Value: true, Layer: LayerProwgen},
+		{Field: "name", Value: "integ-security_istio", Layer: LayerProwgen, Expanded: true},
+		{Field: "path_alias", Value: "istio.io/istio", Layer: LayerBase},
+		{Field: "annotations.testgrid-dashboards", Value: "istio_istio", Layer: LayerBase},
+		{Field: "spec.nodeSelector.testing", Value: "test-pool", Layer: LayerBase},
+		{Field: "spec.containers[0].image", Value: "fooimage", Layer: file},
+		{Field: "spec.containers[0].env[FILE].value", Value: "file", Layer: file},
+		{Field: "spec.containers[0].env[key].value", Value: "job", Layer: job},
+		{Field: "spec.containers[0].command[1]", Value: "test.integration.security.kube", Layer: job, Expanded: true},
+		{Field: "spec.containers[0].args[0]", Value: "-v", Layer: job, Expanded: true},
+		{Field: "optional", Value: true, Layer: "modifier_presets.presubmit_optional_on_label"},
+		{Field: "spec.volumes[build-cache].name", Value: "build-cache", Layer: "requirement_presets.cache"},
+		{Field: "spec.volumes[modules].name", Value: "modules", Layer: "requirement_presets.kind"},
+		{Field: "spec.containers[0].volumeMounts[/lib/modules].name", Value: "modules", Layer: "requirement_presets.kind"},
+		{Field: "spec.containers[0].env[GOMAXPROCS].value", Value: "3", Layer: LayerAutoMaxProcs},
+		{Field: "spec.containers[0].resources.limits.memory", Value: "24Gi", Layer: LayerBase},
+		{Field: "spec.containers[0].resources.requests.cpu", Value: "1", Layer: LayerBase},
+	} {
+		if diff := cmp.Diff(expected, got[expected.Field]); diff != "" {
+			t.Errorf("Provenance of %s does not match, (-want, +got): \n%s", expected.Field, diff)
+		}
+	}
+
+	// The resources come from the file defining the preset of the job, even
+	// the ones the default preset of .base.yaml sets to the same value.
+	e, err = cli.Explain(file, "build_istio_postsubmit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = map[string]FieldProvenance{}
+	for _, f := range e.Fields {
+		got[f.Field] = f
+	}
+	for _, expected := range []FieldProvenance{
+		{Field: "spec.containers[0].resources.limits.memory", Value: "24Gi", Layer: file},
+		{Field: "spec.containers[0].resources.limits.cpu", Value: "8", Layer: file},
+		{Field: "spec.containers[0].resources.requests.memory", Value: "16Gi", Layer: file},
+		{Field: "spec.containers[0].env[GOMAXPROCS].value", Value: "8", Layer: LayerAutoMaxProcs},
+	} {
+		if diff := cmp.Diff(expected, got[expected.Field]); diff != "" {
+			t.Errorf("Provenance of %s does not match, (-want, +got): \n%s", expected.Field, diff)
+		}
+	}
+
+	if _, err := cli.Explain(file, "unit_istio"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	// The fields inherited from the jobs extended by the job come from them.
+	file = "testdata/extends.yaml"
+	e, err = cli.Explain(file, "integ-security-distroless_istio_postsubmit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = map[string]FieldProvenance{}
+	for _, f := range e.Fields {
+		got[f.Field] = f
+	}
+	for _, expected := range []FieldProvenance{
+		{Field: "spec.containers[0].command[0]", Value: "prow/integ-suite-kind.sh", Layer: "extends testdata/extends/pilot.yaml:integ-pilot"},
+		{Field: "spec.containers[0].env[INTEGRATION_TEST_FLAGS].value", Value: "--istio.test.retries=1", Layer: "extends testdata/extends/pilot.yaml:integ-pilot"},
+		{Field: "spec.containers[0].args[0]", Value: "test.integration.security.kube", Layer: "extends testdata/extends.yaml:integ-security"},
+		{Field: "spec.containers[0].env[TEST_SELECT].value", Value: "-multicluster", Layer: "extends testdata/extends.yaml:integ-security"},
+		{Field: "spec.containers[0].env[VARIANT].value", Value: "distroless", Layer: file + " jobs[3]"},
+		{Field: "spec.volumes[modules].name", Value: "modules", Layer: "requirement_presets.kind"},
+	} {
+		if diff := cmp.Diff(expected, got[expected.Field]); diff != "" {
+			t.Errorf("Provenance of %s does not match, (-want, +got): \n%s", expected.Field, diff)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/imdario/mergo"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// extendsKey identifies a job of a meta config file in the extends chains.
+type extendsKey struct {
+	file string
+	job  string
+}
+
+// extendsResolver resolves the parent jobs of the jobs of a meta config file,
+// reading the other meta config files they are in at most once.
+type extendsResolver struct {
+	// root is the directory the files of the parent jobs must be under, if
+	// set.
+	root string
+	jobs map[string][]spec.Job
+}
+
+// resolveExtends replaces the jobs of the meta config file that extend another
+// job with the result of merging them onto their parent. Only the fields of the
+// parent job are inherited, not the ones of its file, which are applied to the
+// job by its own file as usual. The parent jobs must be in files under root,
+// if set.
+func resolveExtends(root, file string, jobs []spec.Job) error {
+	file = filepath.Clean(file)
+	r := &extendsResolver{root: root, jobs: map[string][]spec.Job{file: append([]spec.Job(nil), jobs...)}}
+	var err error
+	for i, job := range jobs {
+		if job.Extends == nil {
+			continue
+		}
+		resolved, e := r.resolve(file, job, nil)
+		if e != nil {
+			err = multierror.Append(err, &FieldError{File: file, Path: fieldPath("jobs", i, "extends"), Err: e})
+			continue
+		}
+		jobs[i] = resolved
+	}
+	return err
+}
+
+// resolve returns the job of the file merged onto its parent jobs. chain is the
+// list of jobs extended by the job so far, to detect the cycles.
+func (r *extendsResolver) resolve(file string, job spec.Job, chain []extendsKey) (spec.Job, error) {
+	if job.Extends == nil {
+		return job, nil
+	}
+	chain = append(chain, extendsKey{file: file, job: job.Name})
+	parentFile, err := r.parentFile(file, job)
+	if err != nil {
+		return job, err
+	}
+	key := extendsKey{file: parentFile, job: job.Extends.Job}
+	for i, k := range chain {
+		if k == key {
+			// The jobs of other files than the one of the job are
+			// prefixed with their file.
+			names := make([]string, 0, len(chain)-i+1)
+			for _, k := range append(chain[i:], key) {
+				if k.file != chain[0].file {
+					k.job = k.file + ":" + k.job
+				}
+				names = append(names, k.job)
+			}
+			return job, fmt.Errorf("%w: %s", ErrExtendsCycle, strings.Join(names, " -> "))
+		}
+	}
+
+	parent, err := r.parent(parentFile, job.Extends.Job)
+	if err != nil {
+		return job, err
+	}
+	parent, err = r.resolve(parentFile, parent, chain)
+	if err != nil {
+		return job, err
+	}
+	return mergeJobs(parent, job)
+}
+
+// parentFile returns the file of the parent job of the job of the file.
+func (r *extendsResolver) parentFile(file string, job spec.Job) (string, error) {
+	if job.Extends.File == "" {
+		return file, nil
+	}
+	if filepath.IsAbs(job.Extends.File) {
+		return "", fmt.Errorf("the file of the parent job %q must be relative to the directory of %s, got %s",
+			job.Extends.Job, file, job.Extends.File)
+	}
+	parentFile := filepath.Join(filepath.Dir(file), job.Extends.File)
+	if r.root != "" && !isUnder(r.root, parentFile) {
+		return "", fmt.Errorf("the file of the parent job %q must be under the input dir %s, got %s",
+			job.Extends.Job, r.root, job.Extends.File)
+	}
+	return parentFile, nil
+}
+
+// parent returns the job with the given name of the file, as written in the
+// file.
+func (r *extendsResolver) parent(file, name string) (spec.Job, error) {
+	jobs, err := r.read(file)
+	if err != nil {
+		return spec.Job{}, err
+	}
+	for _, job := range jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return spec.Job{}, fmt.Errorf("%w: no job named %q in %s", ErrUnknownParentJob, name, file)
+}
+
+// extendedJob is a job extended by another job.
+type extendedJob struct {
+	file string
+	// job is the job as written in its file, and resolved the job merged
+	// onto its own parents.
+	job      spec.Job
+	resolved spec.Job
+}
+
+// extendedJobs returns the jobs extended by the job i of the meta config file,
+// from the farthest one to the parent of the job. The jobs are the ones of the
+// file as written in it.
+func extendedJobs(root, file string, jobs []spec.Job, i int) ([]extendedJob, error) {
+	file = filepath.Clean(file)
+	r := &extendsResolver{root: root, jobs: map[string][]spec.Job{file: jobs}}
+	var extended []extendedJob
+	job := jobs[i]
+	for job.Extends != nil {
+		parentFile, err := r.parentFile(file, job)
+		if err != nil {
+			return nil, err
+		}
+		parent, err := r.parent(parentFile, job.Extends.Job)
+		if err != nil {
+			return nil, err
+		}
+		// Resolving the parent fails on the cycles, which ends the loop.
+		resolved, err := r.resolve(parentFile, parent, nil)
+		if err != nil {
+			return nil, err
+		}
+		extended = append([]extendedJob{{file: parentFile, job: parent, resolved: resolved}}, extended...)
+		file, job = parentFile, parent
+	}
+	return extended, nil
+}
+
+// read returns the jobs of the meta config file, as written in the file. The
+// imports of the file are not inherited, but they are resolved to fail like
+// the generation of the file does.
+func (r *extendsResolver) read(file string) ([]spec.Job, error) {
+	if jobs, ok := r.jobs[file]; ok {
+		return jobs, nil
+	}
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the file of the parent job: %w", err)
+	}
+	jobsConfig := spec.JobsConfig{}
+	if err := yaml.UnmarshalStrict(yamlFile, &jobsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %q: %w", file, err)
+	}
+	// The problems of the imports are reported with the file itself.
+	if _, err := resolveImports(file, jobsConfig.Imports, jobsConfig.CommonConfig); err != nil {
+		return nil, fmt.Errorf("the file of the parent job %s has invalid imports", file)
+	}
+	r.jobs[file] = jobsConfig.Jobs
+	return jobsConfig.Jobs, nil
+}
+
+// isUnder returns true if the file is in the directory tree of dir.
+func isUnder(dir, file string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absFile)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// mergeJobs returns the job merged onto its parent. The common fields are
+// merged like the ones of the base config, file and job, and the other fields
+// of the job replace the ones of the parent if set. As false cannot be told
+// apart from unset, the bool fields set to true by the parent, e.g.
+// disable_release_branching, cannot be set back to false by the job.
+func mergeJobs(parent, job spec.Job) (spec.Job, error) {
+	commonConfig, err := mergeCommonConfig(parent.CommonConfig, job.CommonConfig)
+	if err != nil {
+		return job, err
+	}
+	testgridConfig, err := mergeTestgridConfig(parent.TestgridConfig, job.TestgridConfig)
+	if err != nil {
+		return job, err
+	}
+	// The common fields are merged above, leave them out to not modify the
+	// maps of the job.
+	merged := job
+	merged.CommonConfig, parent.CommonConfig = spec.CommonConfig{}, spec.CommonConfig{}
+	merged.TestgridConfig, parent.TestgridConfig = nil, nil
+	if err := mergo.Merge(&merged, parent); err != nil {
+		return job, fmt.Errorf("failed to merge the parent job: %w", err)
+	}
+	merged.Name = job.Name
+	merged.Extends = nil
+	merged.CommonConfig = commonConfig
+	merged.TestgridConfig = testgridConfig
+	return merged, nil
+}
@@ -15,10 +15,13 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"maps"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,11 +43,22 @@ const (
 	TestGridDashboard   = "testgrid-dashboards"
 	TestGridAlertEmail  = "testgrid-alert-email"
 	TestGridNumFailures = "testgrid-num-failures-to-alert"
+	TestGridTabName     = "testgrid-tab-name"
+	// TestGridAlertStaleResultsHours, TestGridInCellMetric and
+	// TestGridDescription are only set when configured.
+	TestGridAlertStaleResultsHours = "testgrid-alert-stale-results-hours"
+	TestGridInCellMetric           = "testgrid-in-cell-metric"
+	TestGridDescription            = "description"
+	// TestGridCreateTestGroup is set to false on the jobs with TestGrid
+	// disabled.
+	TestGridCreateTestGroup = "testgrid-create-test-group"
 
 	DefaultAutogenHeader = "# THIS FILE IS AUTOGENERATED, DO NOT EDIT IT MANUALLY."
 
 	ArchAMD64 = "amd64"
 	ArchARM64 = "arm64"
+	// label set in the node selector of the jobs to the job architecture
+	archLabel = "kubernetes.io/arch"
 
 	TypePostsubmit = "postsubmit"
 	TypePresubmit  = "presubmit"
@@ -56,85 +70,164 @@ const (
 
 type Client struct {
 	BaseConfig spec.BaseConfig
+	// InputDir is the directory tree of the meta config files. If set, the
+	// jobs can only extend the jobs of the files under it.
+	InputDir string
 
 	LongJobNamesAllowed bool
 }
 
-func ReadBase(baseConfig *spec.BaseConfig, file string) spec.BaseConfig {
-	yamlFile, err := ioutil.ReadFile(file)
+// ReadBase reads the .base.yaml file and overlays it on the given base config,
+// if any.
+func ReadBase(baseConfig *spec.BaseConfig, file string) (spec.BaseConfig, error) {
+	newBaseConfig, fields, err := readBaseFile(file)
 	if err != nil {
-		log.Fatalf("Failed to read %q: %v", file, err)
-	}
-	newBaseConfig := spec.BaseConfig{}
-	if err := yaml.UnmarshalStrict(yamlFile, &newBaseConfig, yaml.DisallowUnknownFields); err != nil {
-		log.Fatalf("Failed to unmarshal %q: %v", file, err)
+		return spec.BaseConfig{}, err
 	}
 	if baseConfig == nil {
-		return newBaseConfig
+		return newBaseConfig, nil
 	}
 
-	mergedBaseConfig := baseConfig.DeepCopy()
-	mergedBaseConfig.CommonConfig = mergeCommonConfig(mergedBaseConfig.CommonConfig, newBaseConfig.CommonConfig)
-
-	return mergedBaseConfig
+	mergedBaseConfig, err := mergeBaseConfig(*baseConfig, newBaseConfig, fields)
+	if err != nil {
+		return spec.BaseConfig{}, fmt.Errorf("failed to merge %q: %w", file, err)
+	}
+	return mergedBaseConfig, nil
 }
 
-// Reads the jobs yaml
-func (cli *Client) ReadJobsConfig(file string) spec.JobsConfig {
+// ReadJobsConfig reads the jobs yaml and overlays it on the base config.
+func (cli *Client) ReadJobsConfig(file string) (spec.JobsConfig, error) {
 	yamlFile, err := ioutil.ReadFile(file)
 	if err != nil {
-		log.Fatalf("Failed to read %q: %v", file, err)
+		return spec.JobsConfig{}, fmt.Errorf("failed to read %q: %w", file, err)
 	}
+	jobsConfig, err := cli.parseJobsConfig(file, yamlFile)
+	if err != nil {
+		var ferr *FieldError
+		if errors.As(err, &ferr) {
+			return spec.JobsConfig{}, err
+		}
+		return spec.JobsConfig{}, fmt.Errorf("failed to unmarshal %q: %w", file, err)
+	}
+	return jobsConfig, nil
+}
+
+// parseJobsConfig unmarshals the meta config in file, resolves the jobs it
+// extends and overlays it on the base config.
+func (cli *Client) parseJobsConfig(file string, yamlFile []byte) (spec.JobsConfig, error) {
+	jobsConfig, err := parseRawJobsConfig(cli.InputDir, file, yamlFile)
+	if err != nil {
+		return jobsConfig, err
+	}
+	return resolveOverwrites(cli.BaseConfig.CommonConfig, cli.BaseConfig.TestgridConfig, jobsConfig)
+}
+
+// parseRawJobsConfig unmarshals the meta config in file and resolves its
+// imports and the jobs it extends, in files under root if set, without
+// overlaying it on the base config.
+func parseRawJobsConfig(root, file string, yamlFile []byte) (spec.JobsConfig, error) {
 	jobsConfig := spec.JobsConfig{}
 	if err := yaml.UnmarshalStrict(yamlFile, &jobsConfig); err != nil {
-		log.Fatalf("Failed to unmarshal %q: %v", file, err)
+		return jobsConfig, err
 	}
 
 	if len(jobsConfig.Branches) == 0 {
 		jobsConfig.Branches = []string{"master"}
 	}
-
-	return resolveOverwrites(cli.BaseConfig.CommonConfig.DeepCopy(), jobsConfig)
+	var err error
+	jobsConfig.CommonConfig, err = resolveImports(file, jobsConfig.Imports, jobsConfig.CommonConfig)
+	if err != nil {
+		return jobsConfig, err
+	}
+	if err := resolveExtends(root, file, jobsConfig.Jobs); err != nil {
+		return jobsConfig, err
+	}
+	return jobsConfig, nil
 }
 
-func deepCopyMap(mp map[string]string) map[string]string {
-	bs, _ := yaml.Marshal(mp)
-	newMap := map[string]string{}
-	if err := yaml.Unmarshal(bs, &newMap); err != nil {
-		log.Fatalf("Failed to unmarshal Map: %v", err)
+func copyMap(mp map[string]string) map[string]string {
+	newMap := make(map[string]string, len(mp))
+	for k, v := range mp {
+		newMap[k] = v
 	}
 	return newMap
 }
 
-func mergeCommonConfig(configs ...spec.CommonConfig) spec.CommonConfig {
+func mergeCommonConfig(configs ...spec.CommonConfig) (spec.CommonConfig, error) {
 	mergedCommonConfig := spec.CommonConfig{}
 	for i := 0; i < len(configs); i++ {
-		config := configs[i].DeepCopy()
+		config, err := configs[i].DeepCopy()
+		if err != nil {
+			return mergedCommonConfig, err
+		}
 		if err := mergo.Merge(&mergedCommonConfig, config,
 			mergo.WithAppendSlice, mergo.WithSliceDeepCopy); err != nil {
-			log.Fatalf("Failed to merge config: %v", err)
+			return mergedCommonConfig, fmt.Errorf("failed to merge config: %w", err)
 		}
 
 		// NodeSelector field is a special case since for Prow jobs we normally only
 		// want to schedule them on dedicated nodes that only matches with one
 		// single label.
 		if len(configs[i].NodeSelector) != 0 {
-			mergedCommonConfig.NodeSelector = deepCopyMap(configs[i].NodeSelector)
+			mergedCommonConfig.NodeSelector = copyMap(configs[i].NodeSelector)
 		}
 	}
-	return mergedCommonConfig
+	return mergedCommonConfig, nil
+}
+
+// mergeTestgridConfig overlays the TestGrid configs, in order of lowest to
+// highest priority. It returns nil if none of the fields is set.
+func mergeTestgridConfig(configs ...*spec.TestgridConfig) (*spec.TestgridConfig, error) {
+	merged := spec.TestgridConfig{}
+	for _, config := range configs {
+		if config == nil {
+			continue
+		}
+		if err := mergo.Merge(&merged, *config, mergo.WithOverride); err != nil {
+			return nil, fmt.Errorf("failed to merge testgrid_config: %w", err)
+		}
+		// enabled and disabled override each other, with disabled winning
+		// if both are set in the same layer.
+		if config.Disabled {
+			merged.Enabled = false
+		} else if config.Enabled {
+			merged.Disabled = false
+		}
+	}
+	if merged == (spec.TestgridConfig{}) {
+		return nil, nil
+	}
+	return &merged, nil
 }
 
-func resolveOverwrites(baseCommonConfig spec.CommonConfig, jobsConfig spec.JobsConfig) spec.JobsConfig {
-	jobsConfig.CommonConfig = mergeCommonConfig(baseCommonConfig, jobsConfig.CommonConfig)
+func resolveOverwrites(baseCommonConfig spec.CommonConfig, baseTestgridConfig spec.TestgridConfig, jobsConfig spec.JobsConfig) (spec.JobsConfig, error) {
+	var err error
+	jobsConfig.CommonConfig, err = mergeCommonConfig(baseCommonConfig, jobsConfig.CommonConfig)
+	if err != nil {
+		return jobsConfig, err
+	}
+	jobsConfig.TestgridConfig, err = mergeTestgridConfig(&baseTestgridConfig, jobsConfig.TestgridConfig)
+	if err != nil {
+		return jobsConfig, err
+	}
 
+	// The jobs are merged in a copy, to leave the ones of the given config as
+	// is, e.g. to generate them again from other layers.
+	jobsConfig.Jobs = append([]spec.Job(nil), jobsConfig.Jobs...)
 	for i, job := range jobsConfig.Jobs {
-		job.CommonConfig = mergeCommonConfig(jobsConfig.CommonConfig, job.CommonConfig)
+		job.CommonConfig, err = mergeCommonConfig(jobsConfig.CommonConfig, job.CommonConfig)
+		if err != nil {
+			return jobsConfig, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		job.TestgridConfig, err = mergeTestgridConfig(jobsConfig.TestgridConfig, job.TestgridConfig)
+		if err != nil {
+			return jobsConfig, fmt.Errorf("job %q: %w", job.Name, err)
+		}
 
 		jobsConfig.Jobs[i] = job
 	}
 
-	return jobsConfig
+	return jobsConfig, nil
 }
 
 // FilterReleaseBranchingJobs filters then returns jobs with release branching enabled.
@@ -151,58 +244,190 @@ func FilterReleaseBranchingJobs(jobs []spec.Job) []spec.Job {
 
 func validateJobsConfig(fileName string, jobsConfig spec.JobsConfig) error {
 	var err error
+	fieldErr := func(e error, path ...interface{}) {
+		err = multierror.Append(err, &FieldError{File: fileName, Path: fieldPath(path...), Err: e})
+	}
 	if jobsConfig.Org == "" {
-		err = multierror.Append(err, fmt.Errorf("%s: org must be set", fileName))
+		fieldErr(errors.New("org must be set"), "org")
 	}
 	if jobsConfig.Repo == "" {
-		err = multierror.Append(err, fmt.Errorf("%s: repo must be set", fileName))
+		fieldErr(errors.New("repo must be set"), "repo")
+	}
+
+	if e := decorator.ValidateMatrixExclude(jobsConfig.MatrixExclude, jobsConfig.Matrix); e != nil {
+		for _, e := range unwrapErrors(e) {
+			fieldErr(e, "matrix_exclude")
+		}
+	}
+	if e := decorator.ValidateMatrixInclude(jobsConfig.MatrixInclude, jobsConfig.Matrix); e != nil {
+		for _, e := range unwrapErrors(e) {
+			fieldErr(e, "matrix_include")
+		}
+	}
+
+	branches := sets.NewString(jobsConfig.Branches...)
+	for _, branch := range sets.StringKeySet(jobsConfig.Images).List() {
+		if !branches.Has(branch) {
+			fieldErr(fmt.Errorf("image set for branch %q, which is not one of the branches %v", branch, jobsConfig.Branches), "images", branch)
+		}
 	}
 
-	for _, job := range jobsConfig.Jobs {
+	// The fields of the file are merged into the ones of its jobs, and are
+	// validated for the file, so only the values the jobs override are left
+	// to validate for them. The fields of the file are validated with an
+	// empty inherited value.
+	validateOverride := func(value, inherited string, validate func(string) error, path ...interface{}) {
+		if value == "" || value == inherited {
+			return
+		}
+		if e := validate(value); e != nil {
+			fieldErr(e, path...)
+		}
+	}
+
+	jobNamePolicies := sets.NewString("", JobNamePolicyError, JobNamePolicyAllow, JobNamePolicyShorten)
+	validateJobNamePolicy := func(policy string) error {
+		return validate(policy, jobNamePolicies, "job_name_policy")
+	}
+	validateOverride(jobsConfig.JobNamePolicy, "", validateJobNamePolicy, "job_name_policy")
+	validateTestgridConfig := func(tg, inherited *spec.TestgridConfig, path ...interface{}) {
+		if tg == nil {
+			return
+		}
+		if inherited == nil {
+			inherited = &spec.TestgridConfig{}
+		}
+		for _, f := range []struct{ name, value, inherited string }{
+			{"num_failures_to_alert", tg.NumFailuresToAlert, inherited.NumFailuresToAlert},
+			{"alert_stale_results_hours", tg.AlertStaleResultsHours, inherited.AlertStaleResultsHours},
+		} {
+			validateOverride(f.value, f.inherited, func(value string) error {
+				if n, e := strconv.Atoi(value); e != nil || n < 0 {
+					return fmt.Errorf("%s must be a non-negative integer, got %q", f.name, value)
+				}
+				return nil
+			}, append(path, "testgrid_config", f.name)...)
+		}
+	}
+	validateTestgridConfig(jobsConfig.TestgridConfig, nil)
+
+	validateOverride(jobsConfig.Resources, "", func(resources string) error {
+		if _, f := jobsConfig.ResourcePresets[resources]; !f {
+			return fmt.Errorf("%w '%v'", decorator.ErrUnknownResource, resources)
+		}
+		return nil
+	}, "resources")
+	for _, name := range sets.StringKeySet(jobsConfig.ResourcePresetOverrides).List() {
+		if _, f := jobsConfig.ResourcePresets[name]; !f {
+			fieldErr(fmt.Errorf("%w '%v'", decorator.ErrUnknownResource, name), "resources_presets_overrides", name)
+		}
+		if e := decorator.ValidateResourcePresetOverrides(jobsConfig.ResourcePresetOverrides[name],
+			sets.NewString(TypePostsubmit, TypePresubmit, TypePeriodic),
+			sets.NewString(ArchAMD64, ArchARM64)); e != nil {
+			for _, e := range unwrapErrors(e) {
+				fieldErr(e, "resources_presets_overrides", name)
+			}
+		}
+	}
+
+	for i, job := range jobsConfig.Jobs {
+		validateOverride(job.JobNamePolicy, jobsConfig.JobNamePolicy, validateJobNamePolicy, "jobs", i, "job_name_policy")
+		validateTestgridConfig(job.TestgridConfig, jobsConfig.TestgridConfig, "jobs", i)
+		// The exclude and include entries of the file come first in the
+		// merged job config, followed by the ones the job adds.
+		if own := job.MatrixExclude[min(len(jobsConfig.MatrixExclude), len(job.MatrixExclude)):]; len(own) > 0 {
+			if e := decorator.ValidateMatrixExclude(own, jobsConfig.Matrix); e != nil {
+				for _, e := range unwrapErrors(e) {
+					fieldErr(e, "jobs", i, "matrix_exclude")
+				}
+			}
+		}
+		if own := job.MatrixInclude[min(len(jobsConfig.MatrixInclude), len(job.MatrixInclude)):]; len(own) > 0 {
+			if e := decorator.ValidateMatrixInclude(own, jobsConfig.Matrix); e != nil {
+				for _, e := range unwrapErrors(e) {
+					fieldErr(e, "jobs", i, "matrix_include")
+				}
+			}
+		}
 		if jobsConfig.Org == "istio" || jobsConfig.Org == "istio-private" {
 			// Some other orgs may have other naming conventions, but for Istio we use _ as divider between job
 			// name, repo, and type. So exclude it from the name.
 			if strings.Contains(job.Name, "_") {
-				err = multierror.Append(err, fmt.Errorf("%s: job may not contain '_' %v", fileName, job.Name))
+				fieldErr(fmt.Errorf("job may not contain '_' %v", job.Name), "jobs", i, "name")
 			}
 		}
-		if job.Image == "" {
-			err = multierror.Append(err, fmt.Errorf("%s: image must be set for job %v", fileName, job.Name))
+		if job.Image == "" && !imagesCoverBranches(jobsConfig) {
+			fieldErr(fmt.Errorf("image must be set for job %v", job.Name), "jobs", i, "image")
 		}
-		if job.Resources != "" {
-			if _, f := jobsConfig.ResourcePresets[job.Resources]; !f {
-				err = multierror.Append(err, fmt.Errorf("%s: job '%v' has nonexistant resource '%v'", fileName, job.Name, job.Resources))
+		validateOverride(job.Resources, jobsConfig.Resources, func(resources string) error {
+			if _, f := jobsConfig.ResourcePresets[resources]; !f {
+				return fmt.Errorf("%w '%v' in job '%v'", decorator.ErrUnknownResource, resources, job.Name)
 			}
-		}
+			return nil
+		}, "jobs", i, "resources")
 
 		if sets.NewString(job.Types...).Has(TypePeriodic) {
 			if job.Cron != "" && job.Interval != "" {
-				err = multierror.Append(err, fmt.Errorf("%s: cron and interval cannot be both set in periodic %s", fileName, job.Name))
+				fieldErr(fmt.Errorf("%w: cron and interval cannot be both set in periodic %s", ErrInvalidSchedule, job.Name), "jobs", i, "cron")
 			} else if job.Cron == "" && job.Interval == "" {
-				err = multierror.Append(err, fmt.Errorf("%s: cron and interval cannot be both empty in periodic %s", fileName, job.Name))
+				fieldErr(fmt.Errorf("%w: cron and interval cannot be both empty in periodic %s", ErrInvalidSchedule, job.Name), "jobs", i)
 			} else if job.Cron != "" {
 				if _, e := cron.Parse(job.Cron); e != nil {
-					err = multierror.Append(err, fmt.Errorf("%s: invalid cron string %s in periodic %s: %v", fileName, job.Cron, job.Name, e))
+					fieldErr(fmt.Errorf("%w %q in periodic %s: %v", ErrInvalidCron, job.Cron, job.Name, e), "jobs", i, "cron")
 				}
 			} else if job.Interval != "" {
 				if _, e := time.ParseDuration(job.Interval); e != nil {
-					err = multierror.Append(err, fmt.Errorf("%s: cannot parse duration %s in periodic %s: %v", fileName, job.Interval, job.Name, e))
+					fieldErr(fmt.Errorf("%w %q in periodic %s: %v", ErrInvalidInterval, job.Interval, job.Name, e), "jobs", i, "interval")
 				}
 			}
 		}
-		for _, t := range job.Types {
+		if job.Regex != "" && job.SkipIfOnlyChanged != "" {
+			fieldErr(fmt.Errorf("%w: regex and skip_if_only_changed cannot be both set in job %s", ErrInvalidChangeMatcher, job.Name), "jobs", i, "skip_if_only_changed")
+		}
+		for _, f := range []struct{ name, value string }{{"regex", job.Regex}, {"skip_if_only_changed", job.SkipIfOnlyChanged}} {
+			if f.value == "" {
+				continue
+			}
+			if _, e := regexp.Compile(f.value); e != nil {
+				fieldErr(fmt.Errorf("%w: %s %q in job %s: %v", ErrInvalidChangeMatcher, f.name, f.value, job.Name, e), "jobs", i, f.name)
+			}
+		}
+		if job.RunBeforeMerge && len(job.Types) > 0 && !sets.NewString(job.Types...).Has(TypePresubmit) {
+			fieldErr(fmt.Errorf("run_before_merge only applies to presubmits, but job %s has types %v", job.Name, job.Types), "jobs", i, "run_before_merge")
+		}
+		for j, t := range job.Types {
 			if e := validate(t, sets.NewString(TypePostsubmit, TypePresubmit, TypePeriodic), "type"); e != nil {
-				err = multierror.Append(err, e)
+				fieldErr(e, "jobs", i, "types", j)
 			}
 		}
-		for _, t := range job.Architectures {
+		for j, t := range job.Architectures {
 			if e := validate(t, sets.NewString(ArchAMD64, ArchARM64, TypePeriodic), "architectures"); e != nil {
-				err = multierror.Append(err, e)
+				fieldErr(e, "jobs", i, "architectures", j)
 			}
 		}
-		for _, repo := range job.Repos {
+		for _, req := range job.Requirements {
+			if req.When == nil {
+				continue
+			}
+			if e := decorator.ValidateRequirementSelector(*req.When,
+				sets.NewString(TypePostsubmit, TypePresubmit, TypePeriodic),
+				sets.NewString(ArchAMD64, ArchARM64)); e != nil {
+				for _, e := range unwrapErrors(e) {
+					fieldErr(fmt.Errorf("requirement %q: %w", req.Name, e), "jobs", i, "requirements")
+				}
+			}
+		}
+		for _, name := range job.Modifiers {
+			// Unknown modifiers are reported when applying them.
+			if m, e := decorator.LookupModifier(name, jobsConfig.ModifierPresets); e == nil {
+				if e := m.Validate(job); e != nil {
+					fieldErr(fmt.Errorf("modifier %q: %w", name, e), "jobs", i, "modifiers")
+				}
+			}
+		}
+		for j, repo := range job.Repos {
 			if len(strings.Split(repo, "/")) != 2 {
-				err = multierror.Append(err, fmt.Errorf("%s: repo %v not valid, should take form org/repo", fileName, repo))
+				fieldErr(fmt.Errorf("repo %v not valid, should take form org/repo", repo), "jobs", i, "repos", j)
 			}
 		}
 	}
@@ -210,6 +435,20 @@ func validateJobsConfig(fileName string, jobsConfig spec.JobsConfig) error {
 	return err
 }
 
+// imagesCoverBranches returns true if an image is set for each of the branches
+// in the images map.
+func imagesCoverBranches(jobsConfig spec.JobsConfig) bool {
+	if len(jobsConfig.Images) == 0 {
+		return false
+	}
+	for _, branch := range jobsConfig.Branches {
+		if _, ok := jobsConfig.Images[branch]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig, branch string) (config.JobConfig, error) {
 	output := config.JobConfig{
 		PresubmitsStatic:  map[string][]config.Presubmit{},
@@ -219,21 +458,71 @@ func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig,
 	if err := validateJobsConfig(fileName, jobsConfig); err != nil {
 		return output, err
 	}
+	return cli.convertJobConfig(fileName, jobsConfig, branch)
+}
 
+// convertJobConfig is ConvertJobConfig without the validation of the meta
+// config, for the partial configs explaining the generated jobs.
+func (cli *Client) convertJobConfig(fileName string, jobsConfig spec.JobsConfig, branch string) (config.JobConfig, error) {
+	output := config.JobConfig{
+		PresubmitsStatic:  map[string][]config.Presubmit{},
+		PostsubmitsStatic: map[string][]config.Postsubmit{},
+		Periodics:         []config.Periodic{},
+	}
 	baseConfig := cli.BaseConfig
-	testgridConfig := baseConfig.TestgridConfig
+	nameTemplate, err := ParseJobNameTemplate(baseConfig.JobNameTemplate)
+	if err != nil {
+		return output, err
+	}
 
 	var presubmits []config.Presubmit
 	var postsubmits []config.Postsubmit
 	var periodics []config.Periodic
 
-	for _, parentJob := range jobsConfig.Jobs {
+	for i, parentJob := range jobsConfig.Jobs {
 		if len(parentJob.Architectures) == 0 {
 			parentJob.Architectures = []string{ArchAMD64}
 		}
+		// The per branch images only replace the default image of the file,
+		// not the ones set by the jobs.
+		if image, ok := jobsConfig.Images[branch]; ok && parentJob.Image == jobsConfig.Image {
+			parentJob.Image = image
+		}
 
-		expandedJobs := decorator.ApplyVariables(parentJob, parentJob.Architectures, jobsConfig.Params, jobsConfig.Matrix, cli.BaseConfig.ClusterOverrides)
+		expandedJobs, err := decorator.ApplyVariables(parentJob, parentJob.Architectures, jobsConfig.Params, jobsConfig.Matrix, cli.BaseConfig.ClusterOverrides, decorator.Builtins{
+			Org:    jobsConfig.Org,
+			Repo:   jobsConfig.Repo,
+			Branch: branch,
+		})
+		if err != nil {
+			return output, &FieldError{File: fileName, Path: fieldPath("jobs", i), Err: err}
+		}
 		for _, job := range expandedJobs {
+			// Conditional requirements may not apply to any of the generated
+			// jobs, so validate all of them upfront.
+			if err := decorator.ValidateRequirements(spec.RequirementNames(job.Requirements), job.ExcludedRequirements, jobsConfig.RequirementPresets); err != nil {
+				return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "requirements"), Err: err}
+			}
+			requirementsFor := func(jobType string) ([]string, error) {
+				reqs, err := decorator.SelectRequirements(job.Requirements, jobType, branch, job.NodeSelector[archLabel])
+				if err != nil {
+					return nil, &FieldError{File: fileName, Path: fieldPath("jobs", i, "requirements"), Err: err}
+				}
+				return reqs, nil
+			}
+			jobName := func(jobType string) (string, error) {
+				name, err := nameTemplate.Name(JobNameData{
+					Job:    job.Name,
+					Org:    jobsConfig.Org,
+					Repo:   jobsConfig.Repo,
+					Branch: branch,
+					Type:   jobType,
+				})
+				if err != nil {
+					return "", &FieldError{File: fileName, Path: fieldPath("jobs", i, "name"), Err: err}
+				}
+				return name, nil
+			}
 			brancher := config.Brancher{
 				Branches: []string{fmt.Sprintf("^%s$", branch)},
 			}
@@ -245,14 +534,14 @@ func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig,
 			testgridJobPrefix += "_" + jobsConfig.Repo
 
 			if len(job.Types) == 0 || sets.NewString(job.Types...).Has(TypePresubmit) {
-				name := fmt.Sprintf("%s_%s", job.Name, jobsConfig.Repo)
-				if branch != "master" {
-					name += "_" + branch
+				name, err := jobName(TypePresubmit)
+				if err != nil {
+					return output, err
 				}
 
-				base, err := cli.createJobBase(baseConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets)
+				base, err := cli.createJobBase(baseConfig, jobsConfig, job, name, branch, TypePresubmit, jobsConfig.ResourcePresets)
 				if err != nil {
-					return output, err
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "name"), Err: err}
 				}
 
 				presubmit := config.Presubmit{
@@ -266,46 +555,55 @@ func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig,
 				if pa, ok := baseConfig.PathAliases[jobsConfig.Org]; ok {
 					presubmit.UtilityConfig.PathAlias = fmt.Sprintf("%s/%s", pa, jobsConfig.Repo)
 				}
-				if job.Regex != "" {
+				if job.Regex != "" || job.SkipIfOnlyChanged != "" {
 					presubmit.RegexpChangeMatcher = config.RegexpChangeMatcher{
-						RunIfChanged: job.Regex,
+						RunIfChanged:      job.Regex,
+						SkipIfOnlyChanged: job.SkipIfOnlyChanged,
 					}
 					presubmit.AlwaysRun = false
 				}
+				presubmit.RunBeforeMerge = job.RunBeforeMerge
 				triggers := []string{
 					// Allow "/test job"
 					"(" + config.DefaultTriggerFor(job.Name) + ")",
 					// Allow "/test job_repo_branch"
 					"(" + config.DefaultTriggerFor(name) + ")",
 				}
+				if base.Name != name {
+					// Allow "/test <shortened name>"
+					triggers = append(triggers, "("+config.DefaultTriggerFor(base.Name)+")")
+				}
 				if job.Trigger != "" {
 					// Allow custom trigger
 					triggers = append(triggers, fmt.Sprintf(`((?m)^%s(\s+|$))`, job.Trigger))
 				}
 				presubmit.Trigger = strings.Join(triggers, `|`)
 				presubmit.RerunCommand = fmt.Sprintf("/test %s", job.Name)
-				if testgridConfig.Enabled {
-					if err := mergo.Merge(&presubmit.JobBase.Annotations, map[string]string{
-						TestGridDashboard: testgridJobPrefix,
-					}); err != nil {
-						return output, err
-					}
+				if err := mergo.Merge(&presubmit.JobBase.Annotations, testgridAnnotations(job.TestgridConfig, testgridJobPrefix, TypePresubmit)); err != nil {
+					return output, err
+				}
+				requirements, err := requirementsFor(TypePresubmit)
+				if err != nil {
+					return output, err
+				}
+				if err := decorator.ApplyModifiersPresubmit(&presubmit, job.Modifiers, jobsConfig.ModifierPresets); err != nil {
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "modifiers"), Err: err}
+				}
+				if err := decorator.ApplyRequirements(baseConfig, &presubmit.JobBase, requirements, job.ExcludedRequirements, jobsConfig.RequirementPresets); err != nil {
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "requirements"), Err: err}
 				}
-				decorator.ApplyModifiersPresubmit(&presubmit, job.Modifiers)
-				decorator.ApplyRequirements(baseConfig, &presubmit.JobBase, job.Requirements, job.ExcludedRequirements, jobsConfig.RequirementPresets)
 				presubmits = append(presubmits, presubmit)
 			}
 
 			if len(job.Types) == 0 || sets.NewString(job.Types...).Has(TypePostsubmit) {
-				name := fmt.Sprintf("%s_%s", job.Name, jobsConfig.Repo)
-				if branch != "master" {
-					name += "_" + branch
+				name, err := jobName(TypePostsubmit)
+				if err != nil {
+					return output, err
 				}
-				name += "_postsubmit"
 
-				base, err := cli.createJobBase(baseConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets)
+				base, err := cli.createJobBase(baseConfig, jobsConfig, job, name, branch, TypePostsubmit, jobsConfig.ResourcePresets)
 				if err != nil {
-					return output, err
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "name"), Err: err}
 				}
 
 				postsubmit := config.Postsubmit{
@@ -318,39 +616,41 @@ func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig,
 				if pa, ok := baseConfig.PathAliases[jobsConfig.Org]; ok {
 					postsubmit.UtilityConfig.PathAlias = fmt.Sprintf("%s/%s", pa, jobsConfig.Repo)
 				}
-				if job.Regex != "" {
+				if job.Regex != "" || job.SkipIfOnlyChanged != "" {
 					postsubmit.RegexpChangeMatcher = config.RegexpChangeMatcher{
-						RunIfChanged: job.Regex,
+						RunIfChanged:      job.Regex,
+						SkipIfOnlyChanged: job.SkipIfOnlyChanged,
 					}
 				}
-				if testgridConfig.Enabled {
-					if err := mergo.Merge(&postsubmit.JobBase.Annotations, map[string]string{
-						TestGridDashboard:   testgridJobPrefix + "_postsubmit",
-						TestGridAlertEmail:  testgridConfig.AlertEmail,
-						TestGridNumFailures: testgridConfig.NumFailuresToAlert,
-					}); err != nil {
-						return output, err
-					}
+				if err := mergo.Merge(&postsubmit.JobBase.Annotations, testgridAnnotations(job.TestgridConfig, testgridJobPrefix+"_postsubmit", TypePostsubmit)); err != nil {
+					return output, err
+				}
+				requirements, err := requirementsFor(TypePostsubmit)
+				if err != nil {
+					return output, err
+				}
+				if err := decorator.ApplyModifiersPostsubmit(&postsubmit, job.Modifiers, jobsConfig.ModifierPresets); err != nil {
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "modifiers"), Err: err}
+				}
+				if err := decorator.ApplyRequirements(baseConfig, &postsubmit.JobBase, requirements, job.ExcludedRequirements, jobsConfig.RequirementPresets); err != nil {
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "requirements"), Err: err}
 				}
-				decorator.ApplyModifiersPostsubmit(&postsubmit, job.Modifiers)
-				decorator.ApplyRequirements(baseConfig, &postsubmit.JobBase, job.Requirements, job.ExcludedRequirements, jobsConfig.RequirementPresets)
 				postsubmits = append(postsubmits, postsubmit)
 			}
 
 			if sets.NewString(job.Types...).Has(TypePeriodic) {
-				name := fmt.Sprintf("%s_%s", job.Name, jobsConfig.Repo)
-				if branch != "master" {
-					name += "_" + branch
+				name, err := jobName(TypePeriodic)
+				if err != nil {
+					return output, err
 				}
-				name += "_periodic"
 
 				// For periodic jobs, the repo needs to be added to the clonerefs and its root directory
 				// should be set as the working directory, so add itself to the repo list here.
 				job.Repos = append([]string{jobsConfig.Org + "/" + jobsConfig.Repo}, job.Repos...)
 
-				base, err := cli.createJobBase(baseConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets)
+				base, err := cli.createJobBase(baseConfig, jobsConfig, job, name, branch, TypePeriodic, jobsConfig.ResourcePresets)
 				if err != nil {
-					return output, err
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "name"), Err: err}
 				}
 				periodic := config.Periodic{
 					JobBase:  base,
@@ -358,21 +658,24 @@ func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig,
 					Cron:     job.Cron,
 					Tags:     job.Tags,
 				}
-				for _, requirement := range job.Requirements {
+				requirements, err := requirementsFor(TypePeriodic)
+				if err != nil {
+					return output, err
+				}
+				for _, requirement := range requirements {
 					if cronstr := jobsConfig.RequirementPresets[requirement].Cron; cronstr != "" {
 						periodic.Cron = cronstr
 					}
 				}
-				if testgridConfig.Enabled {
-					if err := mergo.Merge(&periodic.JobBase.Annotations, map[string]string{
-						TestGridDashboard:   testgridJobPrefix + "_periodic",
-						TestGridAlertEmail:  testgridConfig.AlertEmail,
-						TestGridNumFailures: testgridConfig.NumFailuresToAlert,
-					}); err != nil {
-						return output, err
-					}
+				if err := mergo.Merge(&periodic.JobBase.Annotations, testgridAnnotations(job.TestgridConfig, testgridJobPrefix+"_periodic", TypePeriodic)); err != nil {
+					return output, err
+				}
+				if err := decorator.ApplyModifiersPeriodic(&periodic, job.Modifiers, jobsConfig.ModifierPresets); err != nil {
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "modifiers"), Err: err}
+				}
+				if err := decorator.ApplyRequirements(baseConfig, &periodic.JobBase, requirements, job.ExcludedRequirements, jobsConfig.RequirementPresets); err != nil {
+					return output, &FieldError{File: fileName, Path: fieldPath("jobs", i, "requirements"), Err: err}
 				}
-				decorator.ApplyRequirements(baseConfig, &periodic.JobBase, job.Requirements, job.ExcludedRequirements, jobsConfig.RequirementPresets)
 				periodics = append(periodics, periodic)
 			}
 		}
@@ -392,7 +695,38 @@ func (cli *Client) ConvertJobConfig(fileName string, jobsConfig spec.JobsConfig,
 	return output, nil
 }
 
-func createContainer(jobConfig spec.JobsConfig, job spec.Job, resources map[string]v1.ResourceRequirements) []v1.Container {
+// testgridAnnotations returns the TestGrid annotations of a job of the type
+// added to the dashboard.
+func testgridAnnotations(testgridConfig *spec.TestgridConfig, dashboard, jobType string) map[string]string {
+	switch {
+	case testgridConfig == nil:
+		return nil
+	case testgridConfig.Disabled:
+		return map[string]string{TestGridCreateTestGroup: "false"}
+	case !testgridConfig.Enabled:
+		return nil
+	}
+	annotations := map[string]string{TestGridDashboard: dashboard}
+	if jobType != TypePresubmit || testgridConfig.AlertPresubmits {
+		annotations[TestGridAlertEmail] = testgridConfig.AlertEmail
+		annotations[TestGridNumFailures] = testgridConfig.NumFailuresToAlert
+		if testgridConfig.AlertStaleResultsHours != "" {
+			annotations[TestGridAlertStaleResultsHours] = testgridConfig.AlertStaleResultsHours
+		}
+	}
+	if testgridConfig.TabName != "" {
+		annotations[TestGridTabName] = testgridConfig.TabName
+	}
+	if testgridConfig.Description != "" {
+		annotations[TestGridDescription] = testgridConfig.Description
+	}
+	if testgridConfig.ShortTextMetric != "" {
+		annotations[TestGridInCellMetric] = testgridConfig.ShortTextMetric
+	}
+	return annotations
+}
+
+func createContainer(jobConfig spec.JobsConfig, job spec.Job, jobType string, resources map[string]v1.ResourceRequirements) []v1.Container {
 	envs := joinEnv(jobConfig.Env, job.Env)
 
 	yes := true
@@ -407,7 +741,8 @@ func createContainer(jobConfig spec.JobsConfig, job spec.Job, resources map[stri
 		c.ImagePullPolicy = v1.PullPolicy(job.ImagePullPolicy)
 	}
 
-	decorator.ApplyResource(&c, job.Resources, resources)
+	decorator.ApplyResource(&c, job.Resources, job.NodeSelector[archLabel], jobType,
+		resources, jobConfig.ResourcePresetOverrides)
 
 	return []v1.Container{c}
 }
@@ -440,10 +775,31 @@ func joinEnv(envs ...[]v1.EnvVar) []v1.EnvVar {
 }
 
 func (cli *Client) createJobBase(baseConfig spec.BaseConfig, jobConfig spec.JobsConfig, job spec.Job,
-	name string, branch string, resources map[string]v1.ResourceRequirements) (config.JobBase, error,
+	name string, branch string, jobType string, resources map[string]v1.ResourceRequirements) (config.JobBase, error,
 ) {
-	if len(name) > maxJobNameLength && !cli.LongJobNamesAllowed {
-		return config.JobBase{}, fmt.Errorf("job name exceeds %v character limit '%v'", maxJobNameLength, name)
+	annotations := job.Annotations
+	if len(name) > maxJobNameLength {
+		switch job.JobNamePolicy {
+		case JobNamePolicyShorten:
+			// The annotations map is shared by all the jobs generated from
+			// the same job.
+			annotations = maps.Clone(job.Annotations)
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[FullJobNameAnnotation] = name
+			if tg := job.TestgridConfig; tg != nil && tg.Enabled && tg.TabName == "" {
+				// Keep the TestGrid tab named after the job name template.
+				annotations[TestGridTabName] = name
+			}
+			name = shortenJobName(name)
+		case JobNamePolicyAllow:
+		default:
+			if !cli.LongJobNamesAllowed {
+				return config.JobBase{}, fmt.Errorf("%w: '%v' exceeds %v character limit, use job_name_policy: %s to shorten it",
+					ErrJobNameTooLong, name, maxJobNameLength, JobNamePolicyShorten)
+			}
+		}
 	}
 
 	yes := true
@@ -452,7 +808,7 @@ func (cli *Client) createJobBase(baseConfig spec.BaseConfig, jobConfig spec.Jobs
 		Name:           name,
 		MaxConcurrency: job.MaxConcurrency,
 		Spec: &v1.PodSpec{
-			Containers:   createContainer(jobConfig, job, resources),
+			Containers:   createContainer(jobConfig, job, jobType, resources),
 			NodeSelector: job.NodeSelector,
 			// Disable mounting the service account token. None of our jobs should ever be connecting to the API server.
 			// We do use service accounts, but only for GKE workload identity which doesn't require this.
@@ -466,7 +822,7 @@ func (cli *Client) createJobBase(baseConfig spec.BaseConfig, jobConfig spec.Jobs
 		},
 		ReporterConfig: job.ReporterConfig,
 		Labels:         job.Labels,
-		Annotations:    job.Annotations,
+		Annotations:    annotations,
 		Cluster:        job.Cluster,
 	}
 	if arch, f := job.NodeSelector[v1.LabelArchStable]; f && arch != ArchAMD64 {
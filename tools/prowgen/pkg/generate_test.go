@@ -15,8 +15,11 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -25,11 +28,14 @@ import (
 )
 
 func TestGenerateConfig(t *testing.T) {
-	bc := ReadBase(nil, "testdata/.base.yaml")
+	bc, err := ReadBase(nil, "testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
 	cli := &Client{BaseConfig: bc}
 	tests := []struct {
 		name        string
-		expectError bool
+		expectError error
 	}{
 		{
 			name: "simple",
@@ -37,23 +43,59 @@ func TestGenerateConfig(t *testing.T) {
 		{
 			name: "matrix",
 		},
+		{
+			name: "matrix-exclude",
+		},
 		{
 			name: "params",
 		},
+		{
+			name: "expressions",
+		},
+		{
+			name: "images",
+		},
+		{
+			name: "resources",
+		},
+		{
+			name: "modifiers",
+		},
+		{
+			name: "conditional-requirements",
+		},
+		{
+			name: "short-job-names",
+		},
+		{
+			name: "testgrid",
+		},
+		{
+			name: "change-matchers",
+		},
+		{
+			name: "extends",
+		},
+		{
+			name: "imports",
+		},
 		{
 			name:        "long-job-name",
-			expectError: true,
+			expectError: ErrJobNameTooLong,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			file := fmt.Sprintf("testdata/%s.yaml", tt.name)
-			jobs := cli.ReadJobsConfig(file)
+			jobs, err := cli.ReadJobsConfig(file)
+			if err != nil {
+				t.Fatal(err)
+			}
 			for _, branch := range jobs.Branches {
 				output, err := cli.ConvertJobConfig(file, jobs, branch)
-				if tt.expectError {
-					if err == nil {
-						t.Fatalf("Test %q expected an error, but did not receive one", tt.name)
+				if tt.expectError != nil {
+					if !errors.Is(err, tt.expectError) {
+						t.Fatalf("Test %q expected error %v, but received %v", tt.name, tt.expectError, err)
 					}
 					// there should be no generated file when an error occurs
 					continue
@@ -62,7 +104,9 @@ func TestGenerateConfig(t *testing.T) {
 				}
 				testFile := fmt.Sprintf("testdata/%s.gen.yaml", tt.name)
 				if os.Getenv("REFRESH_GOLDEN") == "true" {
-					Write(output, testFile, bc.AutogenHeader)
+					if err := Write(output, testFile, bc.AutogenHeader); err != nil {
+						t.Fatal(err)
+					}
 				}
 				if err := Check(output, testFile, bc.AutogenHeader); err != nil {
 					t.Fatal(err.Error())
@@ -72,6 +116,53 @@ func TestGenerateConfig(t *testing.T) {
 	}
 }
 
+func TestGenerateConfigJobNameTemplate(t *testing.T) {
+	bc, err := ReadBase(nil, "testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.JobNameTemplate = `{{.Repo}}-{{.Job}}-{{.Type}}`
+	cli := &Client{BaseConfig: bc}
+	file := "testdata/simple.yaml"
+	jobs, err := cli.ReadJobsConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := cli.ConvertJobConfig(file, jobs, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	presubmits := output.PresubmitsStatic["gerrit.istio/istio"]
+	if len(presubmits) == 0 {
+		t.Fatal("expected presubmits")
+	}
+	for _, p := range presubmits {
+		if !strings.HasPrefix(p.Name, "istio-") || !strings.HasSuffix(p.Name, "-presubmit") {
+			t.Errorf("presubmit %q is not named after the template", p.Name)
+		}
+		if !regexp.MustCompile(p.Trigger).MatchString("/test " + p.Name) {
+			t.Errorf("presubmit %q is not triggered by its name", p.Name)
+		}
+	}
+	for _, p := range output.PostsubmitsStatic["gerrit.istio/istio"] {
+		if !strings.HasSuffix(p.Name, "-postsubmit") {
+			t.Errorf("postsubmit %q is not named after the template", p.Name)
+		}
+	}
+
+	// The name of the jobs not running on amd64 is already suffixed with
+	// their architecture.
+	names := map[string]bool{}
+	for _, p := range presubmits {
+		names[p.Name] = true
+	}
+	for _, name := range []string{"istio-multi-arch-presubmit", "istio-multi-arch-arm64-presubmit"} {
+		if !names[name] {
+			t.Errorf("expected a presubmit named %q", name)
+		}
+	}
+}
+
 func TestFilterReleaseBranchingJobs(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/imdario/mergo"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+// resolveImports merges the common config of the meta config or .base.yaml
+// file onto the SharedConfig files it imports. The file wins for the keys it
+// shares with the imports.
+func resolveImports(file string, imports []string, commonConfig spec.CommonConfig) (spec.CommonConfig, error) {
+	if len(imports) == 0 {
+		return commonConfig, nil
+	}
+	var err error
+	configs := make([]spec.CommonConfig, 0, len(imports)+1)
+	for i, path := range imports {
+		imported, e := readSharedConfig(file, path, []string{filepath.Clean(file)})
+		if e != nil {
+			err = multierror.Append(err, &FieldError{File: file, Path: fieldPath("imports", i), Err: e})
+			continue
+		}
+		configs = append(configs, imported)
+	}
+	if err != nil {
+		return commonConfig, err
+	}
+	return overrideCommonConfig(append(configs, commonConfig)...)
+}
+
+// readSharedConfig reads the SharedConfig file imported from the file at path,
+// relative to the directory of the file, along with the files it imports.
+// chain is the list of files importing it, to detect the cycles.
+func readSharedConfig(from, path string, chain []string) (spec.CommonConfig, error) {
+	if filepath.IsAbs(path) {
+		return spec.CommonConfig{}, fmt.Errorf("import %s must be relative to the directory of %s", path, from)
+	}
+	file := filepath.Join(filepath.Dir(from), path)
+	if i := slices.Index(chain, file); i >= 0 {
+		return spec.CommonConfig{}, fmt.Errorf("%w: %s", ErrImportCycle, strings.Join(append(chain[i:], file), " -> "))
+	}
+	chain = append(chain, file)
+
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return spec.CommonConfig{}, fmt.Errorf("failed to read import: %w", err)
+	}
+	shared := spec.SharedConfig{}
+	if err := yaml.UnmarshalStrict(yamlFile, &shared); err != nil {
+		return spec.CommonConfig{}, fmt.Errorf("failed to unmarshal import %q: %w", file, err)
+	}
+
+	configs := make([]spec.CommonConfig, 0, len(shared.Imports)+1)
+	for _, imp := range shared.Imports {
+		imported, err := readSharedConfig(file, imp, chain)
+		if err != nil {
+			return spec.CommonConfig{}, err
+		}
+		configs = append(configs, imported)
+	}
+	configs = append(configs, spec.CommonConfig{
+		ResourcePresets:         shared.ResourcePresets,
+		ResourcePresetOverrides: shared.ResourcePresetOverrides,
+		RequirementPresets:      shared.RequirementPresets,
+		Matrix:                  shared.Matrix,
+		Params:                  shared.Params,
+	})
+	return overrideCommonConfig(configs...)
+}
+
+// overrideCommonConfig merges the common configs in order of lowest to highest
+// priority. Unlike mergeCommonConfig, the values of the keys set in several of
+// them are replaced instead of merged, e.g. a matrix dimension is not appended
+// to.
+func overrideCommonConfig(configs ...spec.CommonConfig) (spec.CommonConfig, error) {
+	merged := spec.CommonConfig{}
+	for _, c := range configs {
+		c, err := c.DeepCopy()
+		if err != nil {
+			return merged, err
+		}
+		if err := mergo.Merge(&merged, c, mergo.WithOverride); err != nil {
+			return merged, fmt.Errorf("failed to merge import: %w", err)
+		}
+	}
+	return merged, nil
+}
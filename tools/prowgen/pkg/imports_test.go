@@ -0,0 +1,69 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+func TestResolveImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"common.yaml": "params: {cluster: common, flags: -v}\nmatrix: {suite: [pilot, security]}\n",
+		"shared.yaml": "imports: [common.yaml]\nparams: {cluster: shared}\nmatrix: {suite: [telemetry]}\n" +
+			"resources_presets: {large: {requests: {cpu: 1}, limits: {cpu: 2}}}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var own spec.CommonConfig
+	if err := yaml.Unmarshal([]byte("params: {cluster: own}\nmatrix: {suite: [ambient]}\n"+
+		"resources_presets: {large: {requests: {cpu: 3}}}\n"), &own); err != nil {
+		t.Fatal(err)
+	}
+
+	// The importing files win for the keys they share with their imports.
+	got, err := resolveImports(filepath.Join(dir, "istio.yaml"), []string{"shared.yaml"}, own)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := yaml.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `matrix:
+  suite:
+  - ambient
+params:
+  cluster: own
+  flags: -v
+resources_presets:
+  large:
+    requests:
+      cpu: "3"
+`
+	if diff := cmp.Diff(expected, string(bs)); diff != "" {
+		t.Fatalf("resolved config does not match, (-want, +got): \n%s", diff)
+	}
+}
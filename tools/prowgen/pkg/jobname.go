@@ -0,0 +1,201 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultJobNameTemplate is the template of the job names when the base config
+// does not set job_name_template, e.g. unit_istio_release-1.30_postsubmit.
+const DefaultJobNameTemplate = `{{.Job}}_{{.Repo}}{{if ne .Branch "master"}}_{{.Branch}}{{end}}` +
+	`{{if ne .Type "presubmit"}}_{{.Type}}{{end}}`
+
+// JobNameData is the data of the job name templates.
+type JobNameData struct {
+	// Job is the name of the job in the meta config file, already suffixed
+	// with the architecture for the jobs not running on amd64, e.g.
+	// unit-arm64.
+	Job    string
+	Org    string
+	Repo   string
+	Branch string
+	// Type is one of presubmit, postsubmit or periodic.
+	Type string
+}
+
+// JobNameTemplate generates the names of the Prow jobs from a Go template over
+// JobNameData.
+type JobNameTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseJobNameTemplate parses the template, or the DefaultJobNameTemplate if
+// text is empty.
+func ParseJobNameTemplate(text string) (*JobNameTemplate, error) {
+	if text == "" {
+		text = DefaultJobNameTemplate
+	}
+	tmpl, err := template.New("job_name_template").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job_name_template: %w", err)
+	}
+	t := &JobNameTemplate{tmpl: tmpl}
+	if _, err := t.Name(JobNameData{Job: "job", Org: "org", Repo: "repo", Branch: "master", Type: TypePresubmit}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Name returns the name of the Prow job.
+func (t *JobNameTemplate) Name(data JobNameData) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("invalid job_name_template: %w", err)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("invalid job_name_template: empty name for job %q", data.Job)
+	}
+	return sb.String(), nil
+}
+
+// jobPlaceholder is the placeholder of the job name parsed back from the Prow
+// job names, which is not expected in the templates.
+const jobPlaceholder = "\x00job\x00"
+
+var placeholderRegex = regexp.MustCompile(regexp.QuoteMeta(jobPlaceholder))
+
+// Rebranch returns the name of the Prow job of the org/repo named name on the
+// from branch, for the to branch. The job name is parsed back from the name,
+// which is matched against the template for each job type. It returns false
+// if the name does not match the template.
+func (t *JobNameTemplate) Rebranch(name, org, repo, from, to string) (string, bool) {
+	var best *JobNameData
+	for _, jobType := range []string{TypePresubmit, TypePostsubmit, TypePeriodic} {
+		data := JobNameData{Job: jobPlaceholder, Org: org, Repo: repo, Branch: from, Type: jobType}
+		pattern, err := t.Name(data)
+		if err != nil {
+			continue
+		}
+		// Turn the placeholders into capture groups.
+		var sb strings.Builder
+		last := 0
+		for _, loc := range placeholderRegex.FindAllStringIndex(pattern, -1) {
+			sb.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+			sb.WriteString("(.+?)")
+			last = loc[1]
+		}
+		sb.WriteString(regexp.QuoteMeta(pattern[last:]))
+		match := regexp.MustCompile("^" + sb.String() + "$").FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		parsed := JobNameData{Org: org, Repo: repo, Branch: to, Type: jobType}
+		consistent := true
+		for _, value := range match[1:] {
+			if parsed.Job != "" && parsed.Job != value {
+				consistent = false
+			}
+			parsed.Job = value
+		}
+		// Prefer the most specific match, e.g. job_repo_postsubmit is a
+		// postsubmit of job rather than a presubmit of job_repo.
+		if consistent && (best == nil || len(parsed.Job) < len(best.Job)) {
+			best = &parsed
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	res, err := t.Name(*best)
+	return res, err == nil
+}
+
+// Policies for the job names longer than the Kubernetes label limit.
+const (
+	// JobNamePolicyError fails the generation, unless long job names are
+	// allowed by the client.
+	JobNamePolicyError = "error"
+	// JobNamePolicyAllow keeps the long job names.
+	JobNamePolicyAllow = "allow"
+	// JobNamePolicyShorten shortens the long job names with shortenJobName.
+	JobNamePolicyShorten = "shorten"
+)
+
+// FullJobNameAnnotation is set on the jobs whose name was shortened to the
+// name they would have had otherwise.
+const FullJobNameAnnotation = "prowgen.istio.io/full-job-name"
+
+// jobNameHashLength is the number of hex digits of the hash suffix of the
+// shortened job names.
+const jobNameHashLength = 6
+
+// jobNameAbbreviations are the abbreviations of the common words of the job
+// names, which are separated by -, _ or . in the names.
+var jobNameAbbreviations = map[string]string{
+	"architecture": "arch",
+	"distroless":   "dl",
+	"experimental": "exp",
+	"integration":  "integ",
+	"kubernetes":   "k8s",
+	"multicluster": "mc",
+	"operator":     "op",
+	"periodic":     "per",
+	"postsubmit":   "post",
+	"presubmit":    "pre",
+	"release":      "rel",
+	"security":     "sec",
+	"telemetry":    "telem",
+}
+
+// shortenJobName returns a name that fits the Kubernetes label limit for the
+// long job name. The words of the name are abbreviated, the result is
+// truncated if still too long, and a hash of the full name is appended to
+// keep the shortened names unique. The result only depends on the name.
+func shortenJobName(name string) string {
+	if len(name) <= maxJobNameLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:jobNameHashLength]
+
+	var sb strings.Builder
+	word := 0
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && !strings.ContainsRune("-_.", rune(name[i])) {
+			continue
+		}
+		if abbr, ok := jobNameAbbreviations[name[word:i]]; ok {
+			sb.WriteString(abbr)
+		} else {
+			sb.WriteString(name[word:i])
+		}
+		if i < len(name) {
+			sb.WriteByte(name[i])
+		}
+		word = i + 1
+	}
+
+	short := sb.String()
+	if limit := maxJobNameLength - len(suffix); len(short) > limit {
+		short = strings.TrimRight(short[:limit], "-_.")
+	}
+	return short + suffix
+}
@@ -0,0 +1,129 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShortenJobName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "unit_istio_release-1.30_postsubmit",
+			want: "unit_istio_release-1.30_postsubmit",
+		},
+		{
+			name: "integ-multicluster-distroless-telemetry_istio_release-1.30_postsubmit",
+			want: "integ-mc-dl-telem_istio_rel-1.30_post-",
+		},
+		{
+			name: "this-is-a-very-long-name-without-any-known-words-to-abbreviate_istio_release-1.30",
+			want: "this-is-a-very-long-name-without-any-known-words-to-abbr-",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := shortenJobName(tc.name)
+			if len(got) > maxJobNameLength {
+				t.Errorf("shortened name %q exceeds %d characters", got, maxJobNameLength)
+			}
+			if !strings.HasPrefix(got, tc.want) {
+				t.Errorf("got %q, want a name starting with %q", got, tc.want)
+			}
+			if again := shortenJobName(tc.name); again != got {
+				t.Errorf("shortening is not deterministic, got %q then %q", got, again)
+			}
+		})
+	}
+
+	// Names that only differ after the truncation are still unique.
+	a := shortenJobName(cases[2].name + "_postsubmit")
+	b := shortenJobName(cases[2].name + "_periodic")
+	if a == b {
+		t.Errorf("expected different shortened names, got %q for both", a)
+	}
+}
+
+func TestJobNameTemplate(t *testing.T) {
+	custom := `{{.Org}}-{{.Repo}}-{{.Job}}{{if ne .Branch "master"}}-{{.Branch}}{{end}}-{{.Type}}`
+	cases := []struct {
+		name     string
+		template string
+		data     JobNameData
+		want     string
+		rebranch string
+	}{
+		{
+			name:     "default presubmit",
+			data:     JobNameData{Job: "unit", Org: "istio", Repo: "istio", Branch: "master", Type: TypePresubmit},
+			want:     "unit_istio",
+			rebranch: "unit_istio_release-1.30",
+		},
+		{
+			name:     "default postsubmit",
+			data:     JobNameData{Job: "release", Org: "istio", Repo: "istio", Branch: "master", Type: TypePostsubmit},
+			want:     "release_istio_postsubmit",
+			rebranch: "release_istio_release-1.30_postsubmit",
+		},
+		{
+			name:     "custom periodic",
+			template: custom,
+			data:     JobNameData{Job: "nightly", Org: "istio", Repo: "proxy", Branch: "master", Type: TypePeriodic},
+			want:     "istio-proxy-nightly-periodic",
+			rebranch: "istio-proxy-nightly-release-1.30-periodic",
+		},
+		{
+			name:     "custom arm64",
+			template: `{{.Job}}_{{.Repo}}`,
+			data:     JobNameData{Job: "unit-arm64", Repo: "istio", Branch: "master", Type: TypePresubmit},
+			want:     "unit-arm64_istio",
+			rebranch: "unit-arm64_istio",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseJobNameTemplate(tc.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tmpl.Name(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got name %q, want %q", got, tc.want)
+			}
+			rebranched, ok := tmpl.Rebranch(got, tc.data.Org, tc.data.Repo, "master", "release-1.30")
+			if !ok || rebranched != tc.rebranch {
+				t.Errorf("got rebranched name %q (%v), want %q", rebranched, ok, tc.rebranch)
+			}
+		})
+	}
+
+	tmpl, err := ParseJobNameTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := tmpl.Rebranch("unit_proxy", "istio", "istio", "master", "release-1.30"); ok {
+		t.Errorf("expected no match for a job of another repo, got %q", got)
+	}
+	if _, err := ParseJobNameTemplate("{{.Name}}"); err == nil {
+		t.Error("expected an error for a template referencing an unknown field")
+	}
+}
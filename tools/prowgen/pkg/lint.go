@@ -0,0 +1,311 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	yamlv3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"istio.io/test-infra/tools/prowgen/pkg/decorator"
+	"istio.io/test-infra/tools/prowgen/pkg/spec"
+)
+
+var (
+	// regex to match the line number reported by the yaml parsers.
+	yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+	// regex to match the field name reported by strict unmarshaling.
+	unknownFieldRegex = regexp.MustCompile(`unknown field "([^"]+)"`)
+)
+
+// Problem is a single issue found when linting a meta config file. Line and
+// Column are 1-based, and are left empty if the problem cannot be attributed
+// to a position in the file, e.g. for fields inherited from .base.yaml.
+type Problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	pos := p.File
+	if p.Line > 0 {
+		pos += fmt.Sprintf(":%d:%d", p.Line, p.Column)
+	}
+	if p.Field != "" {
+		return fmt.Sprintf("%s: %s: %s", pos, p.Field, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", pos, p.Message)
+}
+
+// Lint validates the meta config file and returns all the problems found in
+// it, instead of stopping at the first one. The jobs without problems are then
+// converted to catch generation errors, unless the file-level fields have
+// problems.
+func (cli *Client) Lint(file string) []Problem {
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return []Problem{{File: file, Message: err.Error()}}
+	}
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(yamlFile, &root); err != nil {
+		return []Problem{syntaxProblem(file, &root, err)}
+	}
+	jobsConfig, err := cli.parseJobsConfig(file, yamlFile)
+	if err != nil {
+		var ferr *FieldError
+		if !errors.As(err, &ferr) {
+			return []Problem{syntaxProblem(file, &root, err)}
+		}
+		var problems []Problem
+		for _, e := range unwrapErrors(err) {
+			problems = append(problems, fieldProblem(file, &root, e))
+		}
+		return problems
+	}
+
+	var problems []Problem
+	// The jobs with problems, and whether the file-level fields have some.
+	invalidJobs := sets.NewInt()
+	invalidFile := false
+	if err := validateJobsConfig(file, jobsConfig); err != nil {
+		for _, e := range unwrapErrors(err) {
+			problems = append(problems, fieldProblem(file, &root, e))
+			if i, ok := jobIndex(e); ok {
+				invalidJobs.Insert(i)
+			} else {
+				invalidFile = true
+			}
+		}
+	}
+	for i, job := range jobsConfig.Jobs {
+		// List fields are merged with the ones from .base.yaml and the jobs
+		// config, so the items are located by their value instead of index.
+		addItem := func(err error, field, item string) {
+			for _, e := range unwrapErrors(err) {
+				p := fieldProblem(file, &root, &FieldError{File: file, Path: fieldPath("jobs", i, field), Err: e})
+				for _, path := range [][]string{fieldPath("jobs", i, field), fieldPath(field)} {
+					if n := findScalar(valueAt(&root, path), func(v string) bool { return v == item }); n != nil {
+						p.Line, p.Column = n.Line, n.Column
+						break
+					}
+				}
+				problems = append(problems, p)
+				invalidJobs.Insert(i)
+			}
+		}
+		for _, req := range job.Requirements {
+			if err := decorator.ValidateRequirements([]string{req.Name}, nil, jobsConfig.RequirementPresets); err != nil {
+				addItem(err, "requirements", req.Name)
+			}
+		}
+		for _, req := range job.ExcludedRequirements {
+			if err := decorator.ValidateRequirements(nil, []string{req}, jobsConfig.RequirementPresets); err != nil {
+				addItem(err, "excluded_requirements", req)
+			}
+		}
+		for _, modifier := range job.Modifiers {
+			if err := decorator.ValidateModifier(modifier, jobsConfig.ModifierPresets); err != nil {
+				addItem(err, "modifiers", modifier)
+			}
+		}
+		for _, exp := range decorator.UnresolvedVariables(job, jobsConfig.Params, jobsConfig.Matrix) {
+			p := fieldProblem(file, &root, &FieldError{
+				File: file,
+				Path: fieldPath("jobs", i),
+				Err:  fmt.Errorf("$(%s) is not configured", exp),
+			})
+			contains := func(v string) bool { return strings.Contains(v, "$("+exp+")") }
+			if n := findScalar(valueAt(&root, fieldPath("jobs", i)), contains); n != nil {
+				p.Line, p.Column = n.Line, n.Column
+			}
+			problems = append(problems, p)
+			invalidJobs.Insert(i)
+		}
+	}
+	if invalidFile {
+		return problems
+	}
+
+	// The jobs with problems are left out, so the indexes of the generation
+	// errors are mapped back to the ones of the file.
+	var indexes []int
+	var jobs []spec.Job
+	for i, job := range jobsConfig.Jobs {
+		if !invalidJobs.Has(i) {
+			indexes = append(indexes, i)
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return problems
+	}
+	jobsConfig.Jobs = jobs
+	for _, branch := range jobsConfig.Branches {
+		if _, err := cli.convertJobConfig(file, jobsConfig, branch); err != nil {
+			for _, e := range unwrapErrors(err) {
+				var ferr *FieldError
+				if i, ok := jobIndex(e); ok && errors.As(e, &ferr) {
+					path := append(fieldPath("jobs", indexes[i]), ferr.Path[2:]...)
+					e = &FieldError{File: ferr.File, Path: path, Err: ferr.Err}
+				}
+				problems = append(problems, fieldProblem(file, &root, e))
+			}
+		}
+	}
+	return problems
+}
+
+// jobIndex returns the index of the job the error is about, if it is a
+// FieldError of a job.
+func jobIndex(err error) (int, bool) {
+	var ferr *FieldError
+	if !errors.As(err, &ferr) || len(ferr.Path) < 2 || ferr.Path[0] != "jobs" {
+		return 0, false
+	}
+	i, err := strconv.Atoi(ferr.Path[1])
+	return i, err == nil
+}
+
+// unwrapErrors flattens a multierror into its individual errors.
+func unwrapErrors(err error) []error {
+	var merr *multierror.Error
+	if errors.As(err, &merr) {
+		return merr.Errors
+	}
+	return []error{err}
+}
+
+// syntaxProblem converts a parsing error into a Problem, using the line number
+// or the unknown field name reported by the parser to locate it.
+func syntaxProblem(file string, root *yamlv3.Node, err error) Problem {
+	p := Problem{File: file, Message: err.Error()}
+	if m := yamlLineRegex.FindStringSubmatch(err.Error()); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+		p.Column = 1
+	} else if m := unknownFieldRegex.FindStringSubmatch(err.Error()); m != nil {
+		if n := findKey(root, m[1]); n != nil {
+			p.Line, p.Column = n.Line, n.Column
+		}
+	}
+	return p
+}
+
+// fieldProblem converts an error into a Problem, resolving its position from
+// the node tree if it is a FieldError.
+func fieldProblem(file string, root *yamlv3.Node, err error) Problem {
+	var ferr *FieldError
+	if !errors.As(err, &ferr) {
+		return Problem{File: file, Message: err.Error()}
+	}
+	p := Problem{File: file, Field: ferr.FieldPath(), Message: ferr.Err.Error()}
+	if len(ferr.Path) > 0 {
+		if n := nodeAt(root, ferr.Path); n != nil && n.Line > 0 {
+			p.Line, p.Column = n.Line, n.Column
+		}
+	}
+	return p
+}
+
+// nodeAt returns the node for the given path, or the deepest node along the
+// path that exists in the document. For map entries the key node is returned,
+// so that the position points at the field name.
+func nodeAt(root *yamlv3.Node, path []string) *yamlv3.Node {
+	pos, _ := lookup(root, path)
+	return pos
+}
+
+// valueAt returns the value node for the given path, or nil if it does not
+// exist in the document.
+func valueAt(root *yamlv3.Node, path []string) *yamlv3.Node {
+	_, value := lookup(root, path)
+	return value
+}
+
+// lookup walks the document along the path, and returns the position node of
+// the deepest element found, as well as the value node if the whole path exists.
+func lookup(root *yamlv3.Node, path []string) (*yamlv3.Node, *yamlv3.Node) {
+	n := root
+	if n.Kind == yamlv3.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		n = n.Content[0]
+	}
+	pos := n
+	for _, p := range path {
+		var key, value *yamlv3.Node
+		switch n.Kind {
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == p {
+					key, value = n.Content[i], n.Content[i+1]
+					break
+				}
+			}
+		case yamlv3.SequenceNode:
+			if idx, err := strconv.Atoi(p); err == nil && idx >= 0 && idx < len(n.Content) {
+				key, value = n.Content[idx], n.Content[idx]
+			}
+		}
+		if value == nil {
+			return pos, nil
+		}
+		n, pos = value, key
+	}
+	return pos, n
+}
+
+// findScalar returns the first scalar node under n whose value matches.
+func findScalar(n *yamlv3.Node, match func(string) bool) *yamlv3.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yamlv3.ScalarNode && match(n.Value) {
+		return n
+	}
+	for _, c := range n.Content {
+		if found := findScalar(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findKey returns the first map key node under n with the given name.
+func findKey(n *yamlv3.Node, name string) *yamlv3.Node {
+	if n.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == name {
+				return n.Content[i]
+			}
+		}
+	}
+	for _, c := range n.Content {
+		if found := findKey(c, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
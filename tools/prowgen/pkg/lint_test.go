@@ -0,0 +1,165 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	bc, err := ReadBase(nil, "testdata/.base.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{BaseConfig: bc, InputDir: "testdata/lint"}
+	tests := []struct {
+		name     string
+		problems []string
+	}{
+		{
+			name: "errors",
+			problems: []string{
+				"testdata/lint/errors.yaml:1:1: repo: repo must be set",
+				`testdata/lint/errors.yaml:26:3: images.release-1.99: image set for branch "release-1.99", which is not one of the branches [master]`,
+				"testdata/lint/errors.yaml:8:5: jobs[0].name: job may not contain '_' unit_test",
+				`testdata/lint/errors.yaml:14:5: jobs[1].cron: invalid cron "not a cron" in periodic nightly: ` +
+					"Expected 5 or 6 fields, found 3: not a cron",
+				"testdata/lint/errors.yaml:13:23: jobs[1].types[1]: 'nightly' is not a valid type. Must be one of periodic, postsubmit, presubmit",
+				"testdata/lint/errors.yaml:22:5: jobs[2].resources: unknown resource 'huge' in job 'big'",
+				"testdata/lint/errors.yaml:10:25: jobs[0].requirements: unknown requirement 'unknown' in requirements, " +
+					"must be one of cache, commonargs, deploy, desc, docker, gcp, github, gocache, kind, release, secrets",
+				"testdata/lint/errors.yaml:19:37: jobs[1].modifiers: unknown modifier 'flaky' in modifiers, " +
+					"must be one of hidden, paused, presubmit_optional, presubmit_skipped, report_on_failure_only",
+				"testdata/lint/errors.yaml:18:7: jobs[1]: $(params.missing) is not configured",
+			},
+		},
+		{
+			name: "unknown-field",
+			problems: []string{
+				`testdata/lint/unknown-field.yaml:8:5: error unmarshaling JSON: while decoding JSON: json: unknown field "comand"`,
+			},
+		},
+		{
+			name: "testgrid",
+			problems: []string{
+				`testdata/lint/testgrid.yaml:5:3: testgrid_config.alert_stale_results_hours: alert_stale_results_hours must be a non-negative integer, got "a day"`,
+				`testdata/lint/testgrid.yaml:11:7: jobs[0].testgrid_config.num_failures_to_alert: num_failures_to_alert must be a non-negative integer, got "-1"`,
+			},
+		},
+		{
+			name: "resources",
+			problems: []string{
+				"testdata/lint/resources.yaml:4:1: resources: unknown resource 'huge'",
+				"testdata/lint/resources.yaml:10:3: resources_presets_overrides.large: " +
+					"invalid resource override 's390x' in arch, must be one of amd64, arm64",
+				"testdata/lint/resources.yaml:10:3: resources_presets_overrides.large: " +
+					"invalid resource override 'nightly' in types, must be one of periodic, postsubmit, presubmit",
+				"testdata/lint/resources.yaml:19:3: resources_presets_overrides.small: unknown resource 'small'",
+			},
+		},
+		{
+			name: "change-matchers",
+			problems: []string{
+				"testdata/lint/change-matchers.yaml:9:5: jobs[0].skip_if_only_changed: invalid change matcher: regex and skip_if_only_changed cannot be both set in job unit",
+				"testdata/lint/change-matchers.yaml:13:5: jobs[1].skip_if_only_changed: invalid change matcher: " +
+					"skip_if_only_changed \"(docs/\" in job integ: error parsing regexp: missing closing ): `(docs/`",
+				"testdata/lint/change-matchers.yaml:18:5: jobs[2].run_before_merge: run_before_merge only applies to presubmits, but job build has types [postsubmit]",
+			},
+		},
+		{
+			name: "extends",
+			problems: []string{
+				`testdata/lint/extends.yaml:7:5: jobs[0].extends: unknown parent job: no job named "missing" in testdata/lint/extends.yaml`,
+				"testdata/lint/extends.yaml:11:5: jobs[1].extends: cycle in extends: ping -> pong -> ping",
+				"testdata/lint/extends.yaml:15:5: jobs[2].extends: cycle in extends: pong -> ping -> pong",
+			},
+		},
+		{
+			// The parent jobs must be in the directory tree of the input dir.
+			name: "extends-outside",
+			problems: []string{
+				`testdata/lint/extends-outside.yaml:7:5: jobs[0].extends: the file of the parent job "integ-pilot" must be under the input dir testdata/lint, ` +
+					"got ../extends/pilot.yaml",
+			},
+		},
+		{
+			// The parent file fails like it does when generated.
+			name: "extends-imports",
+			problems: []string{
+				"testdata/lint/extends-imports.yaml:7:5: jobs[0].extends: the file of the parent job testdata/lint/imports.yaml has invalid imports",
+			},
+		},
+		{
+			// A misspelled file must not extend a job of the same file.
+			name: "extends-unknown-field",
+			problems: []string{
+				`testdata/lint/extends-unknown-field.yaml:7:33: error unmarshaling JSON: while decoding JSON: json: unknown field "fil"`,
+			},
+		},
+		{
+			// A misspelled when must not make the requirement unconditional.
+			name: "requirements-unknown-field",
+			problems: []string{
+				`testdata/lint/requirements-unknown-field.yaml:10:9: error unmarshaling JSON: while decoding JSON: json: unknown field "whn"`,
+			},
+		},
+		{
+			// The combinations of the matrix have no value for os.
+			name: "matrix-include",
+			problems: []string{
+				`testdata/lint/matrix-include.yaml:10:5: jobs[0].matrix_include: unknown matrix dimension "os" in matrix_include, ` +
+					"not configured in the matrix map[k8s:[1.28 1.29]]",
+			},
+		},
+		{
+			name: "imports",
+			problems: []string{
+				"testdata/lint/imports.yaml:5:5: imports[0]: failed to read import: open testdata/lint/missing.yaml: no such file or directory",
+				"testdata/lint/imports.yaml:6:5: imports[1]: cycle in imports: testdata/lint/imports/ping.yaml -> testdata/lint/imports/pong.yaml -> testdata/lint/imports/ping.yaml",
+			},
+		},
+		{
+			name: "long-job-name",
+			problems: []string{
+				"testdata/lint/long-job-name.yaml:11:5: jobs[1].name: job name too long: " +
+					"'test-this-is-a-very-long-name-that-is-expected-to-fail_istio_release-1.12_postsubmit' exceeds 63 character limit, use job_name_policy: shorten to shorten it",
+			},
+		},
+		{
+			// The generation errors of the other jobs are reported along
+			// with the problems of a job.
+			name: "partial",
+			problems: []string{
+				"testdata/lint/partial.yaml:10:20: jobs[0].requirements: unknown requirement 'unknown' in requirements, " +
+					"must be one of cache, commonargs, deploy, desc, docker, gcp, github, gocache, kind, release, secrets",
+				"testdata/lint/partial.yaml:12:5: jobs[1].name: job name too long: " +
+					"'test-this-is-a-very-long-name-that-is-expected-to-fail_istio_release-1.12_postsubmit' exceeds 63 character limit, use job_name_policy: shorten to shorten it",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range cli.Lint("testdata/lint/" + tt.name + ".yaml") {
+				got = append(got, p.String())
+			}
+			if diff := cmp.Diff(tt.problems, got); diff != "" {
+				t.Fatalf("Lint problems do not match, (-want, +got): \n%s", diff)
+			}
+		})
+	}
+}
@@ -15,13 +15,16 @@
 package pkg
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/prow/pkg/config"
 	"sigs.k8s.io/yaml"
 
@@ -42,11 +45,11 @@ func WriteJobsConfig(jobsConfig spec.JobsConfig, file string) error {
 func Write(jobs config.JobConfig, fname, header string) error {
 	bs, err := yaml.Marshal(jobs)
 	if err != nil {
-		log.Fatalf("Failed to marshal result: %v", err)
+		return fmt.Errorf("failed to marshal result: %w", err)
 	}
 	dir := filepath.Dir(fname)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		log.Fatalf("failed to create directory %q: %v", dir, err)
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
 	}
 	if header == "" {
 		header = DefaultAutogenHeader
@@ -79,11 +82,63 @@ func Check(jobs config.JobConfig, currentConfigFile string, header string) error
 	return nil
 }
 
+// StaleFiles returns the yaml files under the given directory which are owned
+// by prowgen, i.e. that start with the autogen header, but are not in the set
+// of generated files.
+func StaleFiles(dir, header string, generated sets.String) ([]string, error) {
+	if header == "" {
+		header = DefaultAutogenHeader
+	}
+	prefix := []byte(header + "\n")
+	var stale []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		if generated.Has(filepath.Clean(path)) {
+			return nil
+		}
+		owned, err := hasPrefix(path, prefix)
+		if err != nil {
+			return err
+		}
+		if owned {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// hasPrefix checks whether the content of the file starts with the prefix.
+func hasPrefix(file string, prefix []byte) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, len(prefix))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(buf, prefix), nil
+}
+
 // Print will print out the generated Prow jobs config.
-func Print(jobs config.JobConfig) {
+func Print(jobs config.JobConfig) error {
 	bs, err := yaml.Marshal(jobs)
 	if err != nil {
-		log.Fatalf("Failed to write result: %v", err)
+		return fmt.Errorf("failed to write result: %w", err)
 	}
 	fmt.Println(string(bs))
+	return nil
 }
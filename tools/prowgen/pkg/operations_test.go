@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"istio/istio/istio.istio.master.gen.yaml":       DefaultAutogenHeader + "\nfoo: bar\n",
+		"istio/istio/istio.istio.release-1.2.gen.yaml":  DefaultAutogenHeader + "\nfoo: bar\n",
+		"istio/istio/istio.istio.trusted.master.yaml":   "# Written by hand.\nfoo: bar\n",
+		"istio/proxy/istio.proxy.release-1.2.gen.yaml":  DefaultAutogenHeader + "\n",
+		"istio/proxy/istio.proxy.transformed.gen.yaml":  "# THIS FILE IS AUTOGENERATED by another tool.\n",
+		"istio/proxy/README.md":                         DefaultAutogenHeader + "\n",
+		"istio/proxy/istio.proxy.release-1.2.empty.yml": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generated := sets.NewString(filepath.Join(dir, "istio/istio/istio.istio.master.gen.yaml"))
+	stale, err := StaleFiles(dir, "", generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "istio/istio/istio.istio.release-1.2.gen.yaml"),
+		filepath.Join(dir, "istio/proxy/istio.proxy.release-1.2.gen.yaml"),
+	}
+	if diff := cmp.Diff(expected, stale); diff != "" {
+		t.Fatalf("Stale files do not match, (-want, +got): \n%s", diff)
+	}
+
+	stale, err = StaleFiles(filepath.Join(dir, "missing"), "", generated)
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("Expected no stale files for a missing directory, got %v, %v", stale, err)
+	}
+}
@@ -15,7 +15,9 @@
 package spec
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
 
 	v1 "k8s.io/api/core/v1"
 	prowjob "sigs.k8s.io/prow/pkg/apis/prowjobs/v1"
@@ -31,26 +33,55 @@ type BaseConfig struct {
 
 	AutogenHeader string `json:"autogen_header,omitempty"`
 
+	// Imports are the paths of the SharedConfig files to import, relative to
+	// the directory of the .base.yaml file.
+	Imports []string `json:"imports,omitempty"`
+
 	PathAliases map[string]string `json:"path_aliases,omitempty"`
 
 	ClusterOverrides map[string]string `json:"cluster_overrides,omitempty"`
 
 	TestgridConfig TestgridConfig `json:"testgrid_config,omitempty"`
+
+	// JobNameTemplate is the Go template of the Prow job names, over the job,
+	// org, repo, branch, type and arch of the jobs.
+	JobNameTemplate string `json:"job_name_template,omitempty"`
 }
 
-func (baseConfig *BaseConfig) DeepCopy() BaseConfig {
-	bc, _ := yaml.Marshal(baseConfig)
+// DeepCopy returns a deep copy of the BaseConfig.
+func (baseConfig *BaseConfig) DeepCopy() (BaseConfig, error) {
 	newBaseConfig := BaseConfig{}
+	bc, err := yaml.Marshal(baseConfig)
+	if err != nil {
+		return newBaseConfig, fmt.Errorf("failed to marshal BaseConfig: %w", err)
+	}
 	if err := yaml.Unmarshal(bc, &newBaseConfig); err != nil {
-		log.Fatalf("Failed to unmarshal BaseConfig: %v", err)
+		return newBaseConfig, fmt.Errorf("failed to unmarshal BaseConfig: %w", err)
 	}
-	return newBaseConfig
+	return newBaseConfig, nil
 }
 
+// TestgridConfig configures the TestGrid annotations of the jobs. It can be set
+// in the base config, in a meta config file and on a job, the fields set in a
+// layer overriding the ones of the previous layers.
 type TestgridConfig struct {
-	Enabled            bool   `json:"enabled,omitempty"`
+	Enabled bool `json:"enabled,omitempty"`
+	// Disabled keeps the jobs out of TestGrid, overriding enabled. Unlike not
+	// enabling TestGrid, it also prevents TestGrid from creating the test
+	// groups of the postsubmits and periodics.
+	Disabled           bool   `json:"disabled,omitempty"`
 	AlertEmail         string `json:"alert_email,omitempty"`
 	NumFailuresToAlert string `json:"num_failures_to_alert,omitempty"`
+	// AlertStaleResultsHours alerts when the jobs have no results for that
+	// many hours.
+	AlertStaleResultsHours string `json:"alert_stale_results_hours,omitempty"`
+	// AlertPresubmits also sets the alerts on the presubmits, which are only
+	// set on the postsubmits and periodics otherwise.
+	AlertPresubmits bool   `json:"alert_presubmits,omitempty"`
+	TabName         string `json:"tab_name,omitempty"`
+	Description     string `json:"description,omitempty"`
+	// ShortTextMetric is the metric shown in the cells of the TestGrid tab.
+	ShortTextMetric string `json:"short_text_metric,omitempty"`
 }
 
 // JobsConfig represents the fields that can be defined in a meta job file, and
@@ -60,21 +91,53 @@ type JobsConfig struct {
 
 	SupportReleaseBranching bool `json:"support_release_branching,omitempty"`
 
+	// Imports are the paths of the SharedConfig files to import, relative to
+	// the directory of the meta config file.
+	Imports []string `json:"imports,omitempty"`
+
 	Repo     string   `json:"repo,omitempty"`
 	Org      string   `json:"org,omitempty"`
 	CloneURI string   `json:"clone_uri,omitempty"`
 	Branches []string `json:"branches,omitempty"`
+	// Images overrides the default image of the jobs per branch, e.g. to pin
+	// a different build-tools image for each release branch.
+	Images map[string]string `json:"images,omitempty"`
+	// TestgridConfig overrides the TestGrid config of the base config for the
+	// jobs of the file.
+	TestgridConfig *TestgridConfig `json:"testgrid_config,omitempty"`
 
 	Jobs []Job `json:"jobs,omitempty"`
 }
 
+// SharedConfig is a file of presets, matrix dimensions and params shared by
+// the meta config files and .base.yaml files importing it, which can be
+// anywhere in the tree. The fields of the importing file are merged onto the
+// ones of the imported files, in order, like the ones of a meta config file
+// are merged onto the ones of the base config.
+type SharedConfig struct {
+	// Imports are the paths of other SharedConfig files to import, relative to
+	// the directory of the file.
+	Imports []string `json:"imports,omitempty"`
+
+	ResourcePresets         map[string]v1.ResourceRequirements `json:"resources_presets,omitempty"`
+	ResourcePresetOverrides map[string]ResourcePresetOverrides `json:"resources_presets_overrides,omitempty"`
+	RequirementPresets      map[string]RequirementPreset       `json:"requirement_presets,omitempty"`
+	Matrix                  map[string][]string                `json:"matrix,omitempty"`
+	Params                  map[string]string                  `json:"params,omitempty"`
+}
+
 // Job is the last layer for defining the actual Prow jobs.
 type Job struct {
 	CommonConfig
 
 	DisableReleaseBranching bool `json:"disable_release_branching,omitempty"`
 
-	Name    string   `json:"name,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Extends is the job this job is derived from. The fields of this job
+	// are merged onto the ones of the parent job, like the ones of a job are
+	// merged onto the ones of its file.
+	Extends *JobRef `json:"extends,omitempty"`
+
 	Command []string `json:"command,omitempty"`
 	Args    []string `json:"args,omitempty"`
 	Tags    []string `json:"tags,omitempty"`
@@ -87,6 +150,8 @@ type Job struct {
 	GerritPostsubmitLabel string `json:"gerrit_postsubmit_label,omitempty"`
 
 	ReporterConfig *prowjob.ReporterConfig `json:"reporter_config,omitempty"`
+	// TestgridConfig overrides the TestGrid config of the file for the job.
+	TestgridConfig *TestgridConfig `json:"testgrid_config,omitempty"`
 }
 
 // CommonConfig contains all the common fields that can be overlayed through
@@ -105,12 +170,17 @@ type CommonConfig struct {
 	Labels      map[string]string `json:"labels,omitempty"`
 
 	Matrix map[string][]string `json:"matrix,omitempty"`
-	Params map[string]string   `json:"params,omitempty"`
-
-	ResourcePresets      map[string]v1.ResourceRequirements `json:"resources_presets,omitempty"`
-	RequirementPresets   map[string]RequirementPreset       `json:"requirement_presets,omitempty"`
-	Requirements         []string                           `json:"requirements,omitempty"`
-	ExcludedRequirements []string                           `json:"excluded_requirements,omitempty"`
+	// MatrixExclude removes the combinations matching all the dimension values
+	// of an entry, and MatrixInclude adds an entry as an extra combination.
+	MatrixExclude []map[string]string `json:"matrix_exclude,omitempty"`
+	MatrixInclude []map[string]string `json:"matrix_include,omitempty"`
+	Params        map[string]string   `json:"params,omitempty"`
+
+	ResourcePresets         map[string]v1.ResourceRequirements `json:"resources_presets,omitempty"`
+	ResourcePresetOverrides map[string]ResourcePresetOverrides `json:"resources_presets_overrides,omitempty"`
+	RequirementPresets      map[string]RequirementPreset       `json:"requirement_presets,omitempty"`
+	Requirements            []Requirement                      `json:"requirements,omitempty"`
+	ExcludedRequirements    []string                           `json:"excluded_requirements,omitempty"`
 
 	Env                []v1.EnvVar `json:"env,omitempty"`
 	Image              string      `json:"image,omitempty"`
@@ -118,23 +188,47 @@ type CommonConfig struct {
 	ImagePullSecrets   []string    `json:"image_pull_secrets,omitempty"`
 	ServiceAccountName string      `json:"service_account_name,omitempty"`
 
-	Regex   string `json:"regex,omitempty"`
-	Trigger string `json:"trigger,omitempty"`
+	// Regex is the run_if_changed regex of the jobs, which only run if one of
+	// the changed files matches it. SkipIfOnlyChanged is the opposite, the
+	// jobs are skipped if all the changed files match it, e.g. for docs-only
+	// changes. They cannot be both set.
+	Regex             string `json:"regex,omitempty"`
+	SkipIfOnlyChanged string `json:"skip_if_only_changed,omitempty"`
+	// RunBeforeMerge makes Tide run the presubmits before merging, even if
+	// they are optional or did not run because of the changed files.
+	RunBeforeMerge bool   `json:"run_before_merge,omitempty"`
+	Trigger        string `json:"trigger,omitempty"`
 
 	Timeout        *prowjob.Duration `json:"timeout,omitempty"`
 	MaxConcurrency int               `json:"max_concurrency,omitempty"`
+	// JobNamePolicy is how the generated job names longer than the Kubernetes
+	// label limit are handled, one of error (the default), allow or shorten.
+	JobNamePolicy string `json:"job_name_policy,omitempty"`
 
-	Resources string   `json:"resources,omitempty"`
-	Modifiers []string `json:"modifiers,omitempty"`
+	Resources       string                    `json:"resources,omitempty"`
+	Modifiers       []string                  `json:"modifiers,omitempty"`
+	ModifierPresets map[string]ModifierPreset `json:"modifier_presets,omitempty"`
 }
 
-func (commonConfig *CommonConfig) DeepCopy() CommonConfig {
-	cc, _ := yaml.Marshal(commonConfig)
+// DeepCopy returns a deep copy of the CommonConfig.
+func (commonConfig *CommonConfig) DeepCopy() (CommonConfig, error) {
 	newCommonConfig := CommonConfig{}
+	cc, err := yaml.Marshal(commonConfig)
+	if err != nil {
+		return newCommonConfig, fmt.Errorf("failed to marshal CommonConfig: %w", err)
+	}
 	if err := yaml.Unmarshal(cc, &newCommonConfig); err != nil {
-		log.Fatalf("Failed to unmarshal CommonConfig: %v", err)
+		return newCommonConfig, fmt.Errorf("failed to unmarshal CommonConfig: %w", err)
 	}
-	return newCommonConfig
+	return newCommonConfig, nil
+}
+
+// ResourcePresetOverrides are the allocations merged onto the resource preset
+// of the same name, by resource name, for the jobs of the architecture and of
+// the job type, the job type ones last.
+type ResourcePresetOverrides struct {
+	Arch  map[string]v1.ResourceRequirements `json:"arch,omitempty"`
+	Types map[string]v1.ResourceRequirements `json:"types,omitempty"`
 }
 
 // RequirementPreset can be used to re-use settings across multiple jobs.
@@ -150,13 +244,111 @@ type RequirementPreset struct {
 	PodSpec      *v1.PodSpec       `json:"podSpec,omitempty"` // Use this field to add extra PodSpec fields except containers and metadata
 }
 
-func (r *RequirementPreset) DeepCopy() RequirementPreset {
-	rp, _ := yaml.Marshal(r)
+// DeepCopy returns a deep copy of the RequirementPreset.
+func (r *RequirementPreset) DeepCopy() (RequirementPreset, error) {
 	newRequirementPreset := RequirementPreset{}
+	rp, err := yaml.Marshal(r)
+	if err != nil {
+		return newRequirementPreset, fmt.Errorf("failed to marshal RequirementPreset: %w", err)
+	}
 	if err := yaml.Unmarshal(rp, &newRequirementPreset); err != nil {
-		log.Fatalf("Failed to unmarshal RequirementPreset: %v", err)
+		return newRequirementPreset, fmt.Errorf("failed to unmarshal RequirementPreset: %w", err)
+	}
+	return newRequirementPreset, nil
+}
+
+// Requirement references a requirement preset by name. If When is set, the
+// requirement only applies to the generated Prow jobs it selects. It can be
+// written either as the plain preset name or as an object:
+//
+//	requirements:
+//	- gcp
+//	- name: kind
+//	  when: {types: [postsubmit], branches: ["release-.*"], arch: [arm64]}
+type Requirement struct {
+	Name string               `json:"name"`
+	When *RequirementSelector `json:"when,omitempty"`
+}
+
+// RequirementSelector selects generated Prow jobs by their type, branch and
+// architecture. Empty fields match everything, and the branches are regular
+// expressions matched against the whole branch name.
+type RequirementSelector struct {
+	Types    []string `json:"types,omitempty"`
+	Branches []string `json:"branches,omitempty"`
+	Arch     []string `json:"arch,omitempty"`
+}
+
+func (r *Requirement) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*r = Requirement{}
+		return json.Unmarshal(data, &r.Name)
+	}
+	type requirement Requirement
+	return unmarshalStrict(data, (*requirement)(r))
+}
+
+func (r Requirement) MarshalJSON() ([]byte, error) {
+	if r.When == nil {
+		return json.Marshal(r.Name)
+	}
+	type requirement Requirement
+	return json.Marshal(requirement(r))
+}
+
+// RequirementNames returns the preset names of the requirements.
+func RequirementNames(requirements []Requirement) []string {
+	names := make([]string, 0, len(requirements))
+	for _, req := range requirements {
+		names = append(names, req.Name)
+	}
+	return names
+}
+
+// JobRef references a job by name, in the same meta config file or in the
+// File relative to the directory of the meta config file. It can be written
+// either as the plain job name or as an object:
+//
+//	extends: integ-pilot
+//	extends: {file: ../pilot/istio.yaml, job: integ-pilot}
+type JobRef struct {
+	Job  string `json:"job"`
+	File string `json:"file,omitempty"`
+}
+
+func (r *JobRef) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*r = JobRef{}
+		return json.Unmarshal(data, &r.Job)
+	}
+	type jobRef JobRef
+	return unmarshalStrict(data, (*jobRef)(r))
+}
+
+func (r JobRef) MarshalJSON() ([]byte, error) {
+	if r.File == "" {
+		return json.Marshal(r.Job)
 	}
-	return newRequirementPreset
+	type jobRef JobRef
+	return json.Marshal(jobRef(r))
+}
+
+// unmarshalStrict decodes the object form of the fields with custom
+// unmarshalers, which do not get the unknown fields check of the meta config
+// files, e.g. for a misspelled when to not make a requirement unconditional.
+func unmarshalStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ModifierPreset declares a modifier without writing Go code. Each field is a
+// patch in the Prow job config format, merged into the generated Prow jobs of
+// that type with the JSON merge patch semantics.
+type ModifierPreset struct {
+	Presubmit  map[string]interface{} `json:"presubmit,omitempty"`
+	Postsubmit map[string]interface{} `json:"postsubmit,omitempty"`
+	Periodic   map[string]interface{} `json:"periodic,omitempty"`
 }
 
 type Secret struct {
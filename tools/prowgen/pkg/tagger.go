@@ -0,0 +1,159 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"sigs.k8s.io/yaml"
+)
+
+// ImageTagger adds a tag to an existing image, e.g. to tag the image of the
+// master jobs for a new release branch.
+type ImageTagger interface {
+	// Tag makes the dst image reference point to the same image as src. The
+	// repository of dst is used as is, so dst is usually src with a new tag.
+	Tag(src, dst string) error
+}
+
+// GcloudTagger tags the images with `gcloud container images add-tag`, using
+// the credentials of the gcloud CLI.
+type GcloudTagger struct{}
+
+func (t GcloudTagger) Tag(src, dst string) error {
+	args := t.args(src, dst)
+	if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to tag image %q as %q: %w: %s", src, dst, err, out)
+	}
+	return nil
+}
+
+// Command returns the command to run to add the tag by hand.
+func (t GcloudTagger) Command(src, dst string) string {
+	return strings.Join(t.args(src, dst), " ")
+}
+
+func (GcloudTagger) args(src, dst string) []string {
+	return []string{"gcloud", "container", "images", "add-tag", "--quiet", src, dst}
+}
+
+// RegistryTagger tags the images with the OCI registry API. The credentials
+// are read from the Docker config and the Google application default
+// credentials, unless Options are given.
+type RegistryTagger struct {
+	Options []remote.Option
+}
+
+func (t RegistryTagger) Tag(src, dst string) error {
+	srcRef, err := name.ParseReference(src)
+	if err != nil {
+		return fmt.Errorf("invalid image %q: %w", src, err)
+	}
+	dstTag, err := name.NewTag(dst)
+	if err != nil {
+		return fmt.Errorf("invalid image tag %q: %w", dst, err)
+	}
+	opts := t.Options
+	if opts == nil {
+		opts = []remote.Option{remote.WithAuthFromKeychain(authn.NewMultiKeychain(authn.DefaultKeychain, google.Keychain))}
+	}
+	desc, err := remote.Get(srcRef, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to get image %q: %w", src, err)
+	}
+	if err := remote.Tag(dstTag, desc, opts...); err != nil {
+		return fmt.Errorf("failed to tag image %q as %q: %w", src, dst, err)
+	}
+	return nil
+}
+
+// Command returns the command to run to add the tag by hand. crane talks to
+// the registry API like the RegistryTagger.
+func (RegistryTagger) Command(src, dst string) string {
+	return fmt.Sprintf("crane copy %s %s", src, dst)
+}
+
+// DryRunTagger only logs the tags to add, for someone with the permissions to
+// push to the registry to add them.
+type DryRunTagger struct {
+	// Command returns the command to add a tag by hand, e.g.
+	// GcloudTagger.Command, which is the default.
+	Command func(src, dst string) string
+
+	mu   sync.Mutex
+	seen map[ImageTag]bool
+}
+
+func (t *DryRunTagger) Tag(src, dst string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen == nil {
+		t.seen = map[ImageTag]bool{}
+	}
+	if tag := (ImageTag{Source: src, Target: dst}); !t.seen[tag] {
+		t.seen[tag] = true
+		command := t.Command
+		if command == nil {
+			command = GcloudTagger{}.Command
+		}
+		log.Printf("Please find a maintainer with sufficient permissions and have them run `%s`", command(src, dst))
+	}
+	return nil
+}
+
+// ImageTag is a tag to add to an image, as written by the ManifestTagger.
+type ImageTag struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// ManifestTagger writes the tags to add to a YAML manifest file instead of
+// adding them, e.g. for them to be added later by an automated job. The file
+// is rewritten with all the pending tags each time a tag is added.
+type ManifestTagger struct {
+	Path string
+
+	mu   sync.Mutex
+	tags []ImageTag
+}
+
+func (t *ManifestTagger) Tag(src, dst string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tag := ImageTag{Source: src, Target: dst}
+	for _, existing := range t.tags {
+		if existing == tag {
+			return nil
+		}
+	}
+	t.tags = append(t.tags, tag)
+	bs, err := yaml.Marshal(t.tags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the image tags: %w", err)
+	}
+	if err := os.WriteFile(t.Path, bs, 0o644); err != nil {
+		return fmt.Errorf("failed to write the image tags manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRegistryTagger(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := u.Host + "/istio-testing/build-tools:master-abc"
+	dst := u.Host + "/istio-testing/build-tools:release-1.30-abc"
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tagger := RegistryTagger{Options: []remote.Option{}}
+	if err := tagger.Tag(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	dstRef, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := remote.Get(dstRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagged.Digest != want {
+		t.Errorf("tagged image has digest %v, want %v", tagged.Digest, want)
+	}
+
+	if err := tagger.Tag(u.Host+"/istio-testing/missing:master-abc", dst); err == nil {
+		t.Error("expected an error when tagging a missing image")
+	}
+}
+
+func TestManifestTagger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.yaml")
+	tagger := &ManifestTagger{Path: path}
+	for _, tag := range [][2]string{
+		{"gcr.io/istio-testing/build-tools:master-abc", "gcr.io/istio-testing/build-tools:release-1.30-abc"},
+		{"gcr.io/istio-testing/build-tools:master-abc", "gcr.io/istio-testing/build-tools:release-1.30-abc"},
+		{"gcr.io/istio-testing/tools:master-abc", "gcr.io/istio-testing/tools:release-1.30-abc"},
+	} {
+		if err := tagger.Tag(tag[0], tag[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []ImageTag
+	if err := yaml.Unmarshal(bs, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []ImageTag{
+		{Source: "gcr.io/istio-testing/build-tools:master-abc", Target: "gcr.io/istio-testing/build-tools:release-1.30-abc"},
+		{Source: "gcr.io/istio-testing/tools:master-abc", Target: "gcr.io/istio-testing/tools:release-1.30-abc"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected manifest (-want, +got): %s", diff)
+	}
+}
+
+func TestDryRunTagger(t *testing.T) {
+	src := "gcr.io/istio-testing/build-tools:master-abc"
+	dst := "gcr.io/istio-testing/build-tools:release-1.30-abc"
+	cases := []struct {
+		name   string
+		tagger *DryRunTagger
+		want   string
+	}{
+		{"default", &DryRunTagger{}, "`gcloud container images add-tag --quiet " + src + " " + dst + "`"},
+		{"registry", &DryRunTagger{Command: RegistryTagger{}.Command}, "`crane copy " + src + " " + dst + "`"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			for i := 0; i < 2; i++ {
+				if err := c.tagger.Tag(src, dst); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := strings.Count(buf.String(), c.want); got != 1 {
+				t.Errorf("expected the command %s to be logged once, got %q", c.want, buf.String())
+			}
+		})
+	}
+}
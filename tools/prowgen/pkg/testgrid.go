@@ -0,0 +1,280 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/prow/pkg/config"
+	"sigs.k8s.io/yaml"
+)
+
+// TestGridConfig is the part of the TestGrid config.yaml that lists the
+// dashboards referenced by the testgrid-dashboards annotations of the jobs,
+// and the dashboard groups they belong to.
+type TestGridConfig struct {
+	Dashboards      []Dashboard      `json:"dashboards"`
+	DashboardGroups []DashboardGroup `json:"dashboard_groups"`
+}
+
+// Dashboard is a TestGrid dashboard. The tabs of the dashboard are added by
+// the testgrid-dashboards annotations of the jobs.
+type Dashboard struct {
+	Name string `json:"name"`
+}
+
+// DashboardGroup is a group of TestGrid dashboards.
+type DashboardGroup struct {
+	Name           string   `json:"name"`
+	DashboardNames []string `json:"dashboard_names"`
+}
+
+// GeneratedJobs are the jobs generated for a branch of an org/repo.
+type GeneratedJobs struct {
+	Org    string
+	Repo   string
+	Branch string
+	Jobs   config.JobConfig
+}
+
+// GenerateTestGridConfig returns the TestGrid dashboards of the generated jobs
+// and of the other, e.g. hand-written, job configs, with their dashboard
+// groups. The conventions of the TestGrid config hold by construction:
+//
+//   - there is a group per org, and a group per release branch of the orgs
+//     with dashboards for several repos, e.g. istio_release-1.30;
+//   - every dashboard is in the group with the longest name that prefixes the
+//     dashboard name, and the groups without dashboards are left out;
+//   - the dashboards and groups must start with one of the prefixes, if any.
+func GenerateTestGridConfig(generated []GeneratedJobs, others []config.JobConfig, prefixes []string) (TestGridConfig, error) {
+	dashboards := sets.NewString()
+	groups := sets.NewString()
+	repos := map[string]sets.String{}
+	for _, g := range generated {
+		names := jobDashboards(g.Jobs)
+		if names.Len() == 0 {
+			continue
+		}
+		dashboards.Insert(names.UnsortedList()...)
+		groups.Insert(g.Org)
+		if repos[g.Org] == nil {
+			repos[g.Org] = sets.NewString()
+		}
+		repos[g.Org].Insert(g.Repo)
+	}
+	for _, g := range generated {
+		if strings.HasPrefix(g.Branch, "release-") && repos[g.Org].Len() > 1 && jobDashboards(g.Jobs).Len() > 0 {
+			groups.Insert(g.Org + "_" + g.Branch)
+		}
+	}
+	for _, jc := range others {
+		dashboards.Insert(jobDashboards(jc).UnsortedList()...)
+	}
+
+	var errs error
+	members := map[string][]string{}
+	for _, dashboard := range dashboards.List() {
+		group := ""
+		for _, g := range groups.UnsortedList() {
+			if strings.HasPrefix(dashboard, g) && len(g) > len(group) {
+				group = g
+			}
+		}
+		if group == "" {
+			// A dashboard of the other job configs that is not prefixed by
+			// any of the groups, e.g. org_infrastructure of an org without
+			// generated dashboards, gets a group for its org.
+			group, _, _ = strings.Cut(dashboard, "_")
+		}
+		members[group] = append(members[group], dashboard)
+	}
+
+	cfg := TestGridConfig{Dashboards: []Dashboard{}, DashboardGroups: []DashboardGroup{}}
+	for _, dashboard := range dashboards.List() {
+		if !hasAnyPrefix(dashboard, prefixes) {
+			errs = multierror.Append(errs, fmt.Errorf("dashboard %s must start with one of %v", dashboard, prefixes))
+		}
+		cfg.Dashboards = append(cfg.Dashboards, Dashboard{Name: dashboard})
+	}
+	for _, group := range sets.StringKeySet(members).List() {
+		if !hasAnyPrefix(group, prefixes) {
+			errs = multierror.Append(errs, fmt.Errorf("dashboard group %s must start with one of %v", group, prefixes))
+		}
+		cfg.DashboardGroups = append(cfg.DashboardGroups, DashboardGroup{Name: group, DashboardNames: members[group]})
+	}
+	return cfg, errs
+}
+
+// jobDashboards returns the dashboards the jobs are added to with the
+// testgrid-dashboards annotation.
+func jobDashboards(jc config.JobConfig) sets.String {
+	dashboards := sets.NewString()
+	add := func(annotations map[string]string) {
+		for _, name := range strings.Split(annotations[TestGridDashboard], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				dashboards.Insert(name)
+			}
+		}
+	}
+	for _, jobs := range jc.PresubmitsStatic {
+		for _, job := range jobs {
+			add(job.Annotations)
+		}
+	}
+	for _, jobs := range jc.PostsubmitsStatic {
+		for _, job := range jobs {
+			add(job.Annotations)
+		}
+	}
+	for _, job := range jc.Periodics {
+		add(job.Annotations)
+	}
+	return dashboards
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOtherJobConfigs reads the job config files under dir which are not owned
+// by prowgen, i.e. that do not start with the autogen header.
+func ReadOtherJobConfigs(dir, header string) ([]config.JobConfig, error) {
+	if header == "" {
+		header = DefaultAutogenHeader
+	}
+	prefix := []byte(header + "\n")
+	var configs []config.JobConfig
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		owned, err := hasPrefix(path, prefix)
+		if err != nil || owned {
+			return err
+		}
+		jc, err := config.ReadJobConfig(path)
+		if err != nil {
+			return fmt.Errorf("failed to read job config %s: %w", path, err)
+		}
+		configs = append(configs, jc)
+		return nil
+	})
+	return configs, err
+}
+
+// testGridConfigComments are the comments written above the top-level fields
+// of the TestGrid config, kept from when it was written by hand.
+var testGridConfigComments = map[string]string{
+	"dashboards": "# Dashboards need to be specified here\n" +
+		"# A prow annotation will be invalid if it references a dashboard that doesn't exist\n",
+	"dashboard_groups": "# Group all dashboards\n",
+}
+
+func marshalTestGridConfig(cfg TestGridConfig, header string) ([]byte, error) {
+	bs, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TestGrid config: %w", err)
+	}
+	if header == "" {
+		header = DefaultAutogenHeader
+	}
+	var b strings.Builder
+	b.WriteString(header + "\n")
+	for _, line := range strings.SplitAfter(string(bs), "\n") {
+		// The top-level fields are the only lines not indented.
+		if field, _, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			b.WriteString(testGridConfigComments[field])
+		}
+		b.WriteString(line)
+	}
+	return []byte(b.String()), nil
+}
+
+// WriteTestGridConfig will write the TestGrid config to the given file. It
+// fails if the file holds top-level fields other than the ones generated, as
+// they would be lost.
+func WriteTestGridConfig(cfg TestGridConfig, fname, header string) error {
+	if err := checkTestGridConfigFields(fname); err != nil {
+		return err
+	}
+	output, err := marshalTestGridConfig(cfg, header)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, output, 0o644)
+}
+
+// checkTestGridConfigFields returns an error if the TestGrid config file has
+// top-level fields not generated by prowgen.
+func checkTestGridConfigFields(fname string) error {
+	current, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read current TestGrid config %s: %v", fname, err)
+	}
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(current, &fields); err != nil {
+		return fmt.Errorf("failed to parse current TestGrid config %s: %v", fname, err)
+	}
+	var unknown []string
+	for field := range fields {
+		if _, ok := testGridConfigComments[field]; !ok {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("TestGrid config %s has fields %v not generated by prowgen, which would be lost", fname, unknown)
+	}
+	return nil
+}
+
+// CheckTestGridConfig will diff the TestGrid config and the given file.
+func CheckTestGridConfig(cfg TestGridConfig, fname, header string) error {
+	current, err := os.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("failed to read current TestGrid config %s: %v", fname, err)
+	}
+	output, err := marshalTestGridConfig(cfg, header)
+	if err != nil {
+		return err
+	}
+	if diff := cmp.Diff(string(output), string(current)); diff != "" {
+		return fmt.Errorf("generated TestGrid config is different from file %s\nWant(-), got(+):\n%s", fname, diff)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/prow/pkg/config"
+)
+
+func dashboardJobs(presubmit, postsubmit string) config.JobConfig {
+	jc := config.JobConfig{}
+	if presubmit != "" {
+		jc.PresubmitsStatic = map[string][]config.Presubmit{"org/repo": {{
+			JobBase: config.JobBase{Annotations: map[string]string{TestGridDashboard: presubmit}},
+		}}}
+	}
+	if postsubmit != "" {
+		jc.PostsubmitsStatic = map[string][]config.Postsubmit{"org/repo": {{
+			JobBase: config.JobBase{Annotations: map[string]string{TestGridDashboard: postsubmit}},
+		}}}
+	}
+	return jc
+}
+
+func TestGenerateTestGridConfig(t *testing.T) {
+	generated := []GeneratedJobs{
+		{Org: "istio", Repo: "istio", Branch: "master", Jobs: dashboardJobs("istio_istio", "istio_istio_postsubmit")},
+		{Org: "istio", Repo: "istio", Branch: "release-1.3", Jobs: dashboardJobs("istio_release-1.3_istio", "")},
+		{Org: "istio", Repo: "istio", Branch: "release-1.30", Jobs: dashboardJobs("istio_release-1.30_istio", "istio_release-1.30_istio_postsubmit")},
+		{Org: "istio", Repo: "proxy", Branch: "release-1.30", Jobs: dashboardJobs("istio_release-1.30_proxy, istio_proxy_all", "")},
+		{Org: "istio", Repo: "tools", Branch: "release-1.31", Jobs: dashboardJobs("", "")},
+		{Org: "istio-ecosystem", Repo: "sail-operator", Branch: "release-1.30", Jobs: dashboardJobs("istio-ecosystem_release-1.30_sail-operator", "")},
+	}
+	others := []config.JobConfig{
+		dashboardJobs("istio_infrastructure", ""),
+		dashboardJobs("istio-testing_infrastructure", ""),
+	}
+
+	cfg, err := GenerateTestGridConfig(generated, others, []string{"istio"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TestGridConfig{
+		Dashboards: []Dashboard{
+			{Name: "istio-ecosystem_release-1.30_sail-operator"},
+			{Name: "istio-testing_infrastructure"},
+			{Name: "istio_infrastructure"},
+			{Name: "istio_istio"},
+			{Name: "istio_istio_postsubmit"},
+			{Name: "istio_proxy_all"},
+			{Name: "istio_release-1.30_istio"},
+			{Name: "istio_release-1.30_istio_postsubmit"},
+			{Name: "istio_release-1.30_proxy"},
+			{Name: "istio_release-1.3_istio"},
+		},
+		DashboardGroups: []DashboardGroup{
+			{Name: "istio", DashboardNames: []string{"istio-testing_infrastructure", "istio_infrastructure", "istio_istio", "istio_istio_postsubmit", "istio_proxy_all"}},
+			{Name: "istio-ecosystem", DashboardNames: []string{"istio-ecosystem_release-1.30_sail-operator"}},
+			{Name: "istio_release-1.3", DashboardNames: []string{"istio_release-1.3_istio"}},
+			{Name: "istio_release-1.30", DashboardNames: []string{"istio_release-1.30_istio", "istio_release-1.30_istio_postsubmit", "istio_release-1.30_proxy"}},
+		},
+	}
+	if diff := cmp.Diff(expected, cfg); diff != "" {
+		t.Fatalf("TestGrid config does not match, (-want, +got): \n%s", diff)
+	}
+
+	if _, err := GenerateTestGridConfig(generated, others, []string{"istio_"}); err == nil {
+		t.Fatal("Expected an error for the dashboards not starting with the prefixes")
+	}
+
+	// Dashboards without a matching group get a group for their org.
+	cfg, err = GenerateTestGridConfig(nil, []config.JobConfig{dashboardJobs("envoy_infrastructure", "")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]DashboardGroup{{Name: "envoy", DashboardNames: []string{"envoy_infrastructure"}}}, cfg.DashboardGroups); diff != "" {
+		t.Fatalf("TestGrid dashboard groups do not match, (-want, +got): \n%s", diff)
+	}
+}
+
+func TestMarshalTestGridConfig(t *testing.T) {
+	cfg := TestGridConfig{
+		Dashboards:      []Dashboard{{Name: "istio_istio"}},
+		DashboardGroups: []DashboardGroup{{Name: "istio", DashboardNames: []string{"istio_istio"}}},
+	}
+	bs, err := marshalTestGridConfig(cfg, "# autogenerated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# autogenerated
+# Group all dashboards
+dashboard_groups:
+- dashboard_names:
+  - istio_istio
+  name: istio
+# Dashboards need to be specified here
+# A prow annotation will be invalid if it references a dashboard that doesn't exist
+dashboards:
+- name: istio_istio
+`
+	if diff := cmp.Diff(expected, string(bs)); diff != "" {
+		t.Fatalf("TestGrid config does not match, (-want, +got): \n%s", diff)
+	}
+}
+
+func TestWriteTestGridConfig(t *testing.T) {
+	cfg := TestGridConfig{Dashboards: []Dashboard{{Name: "istio_istio"}}}
+	fname := filepath.Join(t.TempDir(), "config.yaml")
+	if err := WriteTestGridConfig(cfg, fname, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Re-writing the generated file is fine.
+	if err := WriteTestGridConfig(cfg, fname, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fname, []byte("dashboards: []\ntest_groups: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := WriteTestGridConfig(cfg, fname, "")
+	if err == nil || !strings.Contains(err.Error(), "test_groups") {
+		t.Fatalf("Expected an error for the test_groups field, got %v", err)
+	}
+}
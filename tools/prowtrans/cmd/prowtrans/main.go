@@ -1090,17 +1090,20 @@ func writeOutFile(o options, p string, pre map[string][]config.Presubmit, post m
 // loadRequirementPresets reads one or more YAML files containing a top-level
 // `requirement_presets` map (as defined by prowgen's BaseConfig). Later files
 // override earlier ones on key collisions.
-func loadRequirementPresets(paths []string) map[string]spec.RequirementPreset {
+func loadRequirementPresets(paths []string) (map[string]spec.RequirementPreset, error) {
 	merged := map[string]spec.RequirementPreset{}
 	var base *spec.BaseConfig
 	for _, p := range paths {
-		bc := prowgen.ReadBase(base, p)
+		bc, err := prowgen.ReadBase(base, p)
+		if err != nil {
+			return nil, err
+		}
 		base = &bc
 		for k, v := range bc.CommonConfig.RequirementPresets {
 			merged[k] = v
 		}
 	}
-	return merged
+	return merged, nil
 }
 
 // applyRequirements applies prowgen-style requirement presets to a job. When
@@ -1131,7 +1134,9 @@ func applyRequirements(o options, job *config.JobBase) {
 
 	// Pass an empty BaseConfig so applyAutoMaxProcs is a no-op (GOMAXPROCS is
 	// already present on the input job from the original prowgen run).
-	decorator.ApplyRequirements(spec.BaseConfig{}, job, o.Requirements, nil, o.RequirementPresetMap)
+	if err := decorator.ApplyRequirements(spec.BaseConfig{}, job, o.Requirements, nil, o.RequirementPresetMap); err != nil {
+		util.PrintErrAndExit(err)
+	}
 }
 
 func generateJobs(o options) {
@@ -1281,7 +1286,11 @@ func Main() {
 		util.PrintErrAndExit(err)
 	}
 
-	o.RequirementPresetMap = loadRequirementPresets(o.RequirementPresetPaths)
+	presetMap, err := loadRequirementPresets(o.RequirementPresetPaths)
+	if err != nil {
+		util.PrintErrAndExit(err)
+	}
+	o.RequirementPresetMap = presetMap
 
 	optsList := []options{o}
 	optsList = append(optsList, o.parseConfiguration()...)